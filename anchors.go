@@ -0,0 +1,114 @@
+package yaml
+
+// AnchorGraph describes the anchors defined in a YAML stream and the
+// aliases referencing them, as returned by ParseAnchorGraph.
+type AnchorGraph struct {
+	// Anchors holds every anchor defined, in the order found.
+	Anchors []*Anchor
+}
+
+// Anchor describes an anchor of an AnchorGraph.
+type Anchor struct {
+	// Name is the name of the anchor, without the leading "&".
+	Name string
+
+	// Document is the index of the document defining the anchor within
+	// the stream, starting at zero.
+	Document int
+
+	// Line and Column hold the position of the anchored node, which is
+	// the one of the anchor itself.
+	Line   int
+	Column int
+
+	// Node is the anchored node.
+	Node *Node
+
+	// Aliases holds the alias nodes referencing the anchor.
+	Aliases []*Node
+
+	// Uses holds the anchors referenced by aliases within the anchored
+	// node, each of them once.
+	Uses []*Anchor
+
+	// Cyclic tells whether the anchored node contains an alias to the
+	// anchor itself, directly or through the anchors it uses.
+	Cyclic bool
+}
+
+// ParseAnchorGraph parses all the documents in src and returns the graph
+// of their anchors, with the aliases referencing each of them and the
+// anchors used within the anchored nodes.
+func ParseAnchorGraph(src []byte) (g *AnchorGraph, err error) {
+	defer handleErr(&err)
+	p := newParser(src)
+	defer p.destroy()
+	g = &AnchorGraph{}
+	anchors := make(map[*Node]*Anchor)
+	for doc := 0; ; doc++ {
+		n := p.parse()
+		if n == nil {
+			break
+		}
+		g.walk(n, doc, anchors, nil)
+	}
+	for _, a := range g.Anchors {
+		a.Cyclic = a.reaches(a, make(map[*Anchor]bool))
+	}
+	return g, nil
+}
+
+// walk records the anchors and aliases within the tree rooted at n, with
+// enclosing holding the anchors of the nodes containing it.
+func (g *AnchorGraph) walk(n *Node, doc int, anchors map[*Node]*Anchor, enclosing []*Anchor) {
+	if n.Kind == AliasNode {
+		target := anchors[n.Alias]
+		if target == nil {
+			return
+		}
+		target.Aliases = append(target.Aliases, n)
+		for _, e := range enclosing {
+			e.use(target)
+		}
+		return
+	}
+	if n.Anchor != "" {
+		a := &Anchor{Name: n.Anchor, Document: doc, Line: n.Line, Column: n.Column, Node: n}
+		anchors[n] = a
+		g.Anchors = append(g.Anchors, a)
+		enclosing = append(enclosing[:len(enclosing):len(enclosing)], a)
+	}
+	for _, c := range n.Content {
+		g.walk(c, doc, anchors, enclosing)
+	}
+}
+
+func (a *Anchor) use(b *Anchor) {
+	for _, u := range a.Uses {
+		if u == b {
+			return
+		}
+	}
+	a.Uses = append(a.Uses, b)
+}
+
+// reaches returns whether target is used by a, directly or not.
+func (a *Anchor) reaches(target *Anchor, seen map[*Anchor]bool) bool {
+	seen[a] = true
+	for _, u := range a.Uses {
+		if u == target || !seen[u] && u.reaches(target, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCycles returns whether any anchor of the graph is cyclic.
+func (g *AnchorGraph) HasCycles() bool {
+	for _, a := range g.Anchors {
+		if a.Cyclic {
+			return true
+		}
+	}
+	return false
+}
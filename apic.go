@@ -59,6 +59,20 @@ func yaml_parser_delete(parser *yaml_parser_t) {
 	*parser = yaml_parser_t{}
 }
 
+// Reset a parser object for a new input, keeping the memory allocated
+// for its buffers and stacks.
+func yaml_parser_reset(parser *yaml_parser_t) {
+	*parser = yaml_parser_t{
+		raw_buffer:  parser.raw_buffer[:0],
+		buffer:      parser.buffer[:0],
+		tokens:      parser.tokens[:0],
+		indents:     parser.indents[:0],
+		simple_keys: parser.simple_keys[:0],
+		states:      parser.states[:0],
+		marks:       parser.marks[:0],
+	}
+}
+
 // String read handler.
 func yaml_string_read_handler(parser *yaml_parser_t, buffer []byte) (n int, err error) {
 	if parser.input_pos == len(parser.input) {
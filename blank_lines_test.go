@@ -2,6 +2,7 @@ package yaml_test
 
 import (
 	"bytes"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -98,6 +99,74 @@ key3: value3
     - item1
 
     - item2
+`,
+		},
+		{
+			name: "standalone comment between blank lines",
+			input: `key1: v1
+
+# orphan comment
+
+key2: v2
+`,
+			expected: `key1: v1
+
+# orphan comment
+
+key2: v2
+`,
+		},
+		{
+			name: "standalone comment after empty value",
+			input: `first: 1
+key1:
+
+# orphan comment
+
+key2: v2
+`,
+			expected: `first: 1
+key1:
+
+# orphan comment
+
+key2: v2
+`,
+		},
+		{
+			name: "standalone comment between sequence items",
+			input: `items:
+  - item1
+
+  # orphan comment
+
+  - item2
+`,
+			expected: `items:
+  - item1
+
+  # orphan comment
+
+  - item2
+`,
+		},
+		{
+			name: "sequence of mappings with blank lines",
+			input: `items:
+  - name: a
+    value: 1
+
+  - name: b
+
+    value: 2
+`,
+			expected: `items:
+  - name: a
+    value: 1
+
+  - name: b
+
+    value: 2
 `,
 		},
 	}
@@ -134,6 +203,80 @@ key3: value3
 	}
 }
 
+func TestBlankLinesOnSequenceItemMappings(t *testing.T) {
+	input := `- name: a
+  value: 1
+
+- name: b
+  value: 2
+`
+	dec := yaml.NewDecoder(strings.NewReader(input))
+	dec.SetPreserveBlankLines(true)
+	var node yaml.Node
+	if err := dec.Decode(&node); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	// The gap belongs to the second item, not to its first key.
+	item := node.Content[0].Content[1]
+	if item.BlankLinesBefore != 1 {
+		t.Errorf("Expected BlankLinesBefore=1 on the item, got %d", item.BlankLinesBefore)
+	}
+	if item.Content[0].BlankLinesBefore != 0 {
+		t.Errorf("Expected BlankLinesBefore=0 on the first key, got %d", item.Content[0].BlankLinesBefore)
+	}
+}
+
+func TestBlankLinesBeforeFootComments(t *testing.T) {
+	input := `a:
+  b:
+    c: 1
+
+    # foot of c
+  d: 2
+
+  # foot of d
+
+e: 3
+`
+	dec := yaml.NewDecoder(strings.NewReader(input))
+	dec.SetPreserveBlankLines(true)
+	var node yaml.Node
+	if err := dec.Decode(&node); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	// The gap before a foot comment is kept as leading line breaks,
+	// as the gap after it is kept as trailing ones.
+	inner := node.Content[0].Content[1].Content[1]
+	if foot := inner.Content[0].FootComment; foot != "\n# foot of c" {
+		t.Errorf("Expected foot comment %q on c, got %q", "\n# foot of c", foot)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	encoder.SetPreserveBlankLines(true)
+	if err := encoder.Encode(&node); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	encoder.Close()
+	if output := buf.String(); output != input {
+		t.Errorf("Blank lines before foot comments not preserved.\nExpected:\n%s\nGot:\n%s", input, output)
+	}
+
+	// Without preservation the foot comments follow their values.
+	node = yaml.Node{}
+	dec = yaml.NewDecoder(strings.NewReader(input))
+	if err := dec.Decode(&node); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	inner = node.Content[0].Content[1].Content[1]
+	if foot := inner.Content[0].FootComment; foot != "# foot of c" {
+		t.Errorf("Expected foot comment %q on c, got %q", "# foot of c", foot)
+	}
+}
+
 func TestBlankLinePreservationDisabled(t *testing.T) {
 	// Save original flag state
 	originalFlag := yaml.PreserveBlankLines
@@ -250,3 +393,129 @@ key3:
 		}
 	})
 }
+
+func TestFindExcessBlankLines(t *testing.T) {
+	input := `a: 1
+
+b:
+  c: 2
+
+
+
+  d:
+    - x
+
+    - y
+"e.f": 3
+`
+	dec := yaml.NewDecoder(strings.NewReader(input))
+	dec.SetPreserveBlankLines(true)
+	var node yaml.Node
+	if err := dec.Decode(&node); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+
+	got := node.FindExcessBlankLines(1)
+	want := []yaml.Violation{{Path: "b.d", Count: 3, Line: 8}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected violations with max 1.\nExpected: %+v\nGot: %+v", want, got)
+	}
+
+	got = node.FindExcessBlankLines(0)
+	want = []yaml.Violation{
+		{Path: "b", Count: 1, Line: 3},
+		{Path: "b.d", Count: 3, Line: 8},
+		{Path: "b.d[1]", Count: 1, Line: 11},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected violations with max 0.\nExpected: %+v\nGot: %+v", want, got)
+	}
+}
+
+func TestNormalizeBlankLines(t *testing.T) {
+	input := `a: 1
+
+
+
+b:
+  - x
+
+
+
+  - y
+
+# Comment for c
+
+c: 3
+`
+	decode := func() *yaml.Node {
+		dec := yaml.NewDecoder(strings.NewReader(input))
+		dec.SetPreserveBlankLines(true)
+		var node yaml.Node
+		if err := dec.Decode(&node); err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		return &node
+	}
+	encode := func(node *yaml.Node) string {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		enc.SetPreserveBlankLines(true)
+		if err := enc.Encode(node); err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		enc.Close()
+		return buf.String()
+	}
+
+	node := decode()
+	node.NormalizeBlankLines(1)
+	if v := node.FindExcessBlankLines(1); len(v) > 0 {
+		t.Errorf("Unexpected violations after normalizing: %+v", v)
+	}
+	expected := `a: 1
+
+b:
+  - x
+
+  - y
+
+# Comment for c
+
+c: 3
+`
+	if output := encode(node); output != expected {
+		t.Errorf("Blank lines not normalized.\nExpected:\n%s\nGot:\n%s", expected, output)
+	}
+
+	node = decode()
+	node.RemoveBlankLines()
+	expected = `a: 1
+b:
+  - x
+  - y
+# Comment for c
+c: 3
+`
+	if output := encode(node); output != expected {
+		t.Errorf("Blank lines not removed.\nExpected:\n%s\nGot:\n%s", expected, output)
+	}
+
+	// Blank lines kept as line breaks around comments are clamped, and
+	// the comments are otherwise left alone.
+	comments := &yaml.Node{
+		Kind:        yaml.ScalarNode,
+		Value:       "x",
+		HeadComment: "# One\n\n# Two\n\n",
+		FootComment: "\n\n\n# Foot\n",
+	}
+	comments.NormalizeBlankLines(1)
+	if comments.HeadComment != "# One\n\n# Two\n" || comments.FootComment != "\n# Foot\n" {
+		t.Errorf("Comment breaks not clamped to 1, got head %q and foot %q", comments.HeadComment, comments.FootComment)
+	}
+	comments.NormalizeBlankLines(0)
+	if comments.HeadComment != "# One\n\n# Two" || comments.FootComment != "# Foot" {
+		t.Errorf("Comment breaks not removed, got head %q and foot %q", comments.HeadComment, comments.FootComment)
+	}
+}
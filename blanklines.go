@@ -0,0 +1,129 @@
+package yaml
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Violation describes a node preceded by more blank lines than allowed,
+// as reported by FindExcessBlankLines.
+type Violation struct {
+	// Path locates the node from the root, such as "spec.containers[0].name".
+	// Mapping keys which aren't simple words are quoted in brackets, as in
+	// `labels["app.kubernetes.io/name"]`.
+	Path string
+
+	// Count is the number of blank lines found before the node.
+	Count int
+
+	// Line is the line of the node in the source, starting at 1.
+	Line int
+}
+
+// FindExcessBlankLines walks the tree rooted at n and reports every node
+// with more than max blank lines before it, in document order. Blank lines
+// preceding a mapping entry are reported with the path of its value.
+//
+// The tree must have been decoded with blank line preservation enabled for
+// the counts to be available.
+func (n *Node) FindExcessBlankLines(max int) []Violation {
+	var violations []Violation
+	var walk func(n *Node, path string)
+	check := func(n *Node, path string) {
+		if n.BlankLinesBefore > max {
+			violations = append(violations, Violation{Path: path, Count: n.BlankLinesBefore, Line: n.Line})
+		}
+	}
+	walk = func(n *Node, path string) {
+		switch n.Kind {
+		case DocumentNode:
+			for _, c := range n.Content {
+				check(c, path)
+				walk(c, path)
+			}
+		case SequenceNode:
+			for i, c := range n.Content {
+				p := path + "[" + strconv.Itoa(i) + "]"
+				check(c, p)
+				walk(c, p)
+			}
+		case MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				k, v := n.Content[i], n.Content[i+1]
+				p := appendPathKey(path, k)
+				check(k, p)
+				walk(v, p)
+			}
+		}
+	}
+	walk(n, "")
+	return violations
+}
+
+// appendPathKey returns path extended with the mapping key k.
+func appendPathKey(path string, k *Node) string {
+	key := k.Value
+	if k.Kind != ScalarNode {
+		key = k.ShortTag()
+	}
+	if key == "" || strings.IndexFunc(key, isNotPathWordRune) >= 0 {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func isNotPathWordRune(r rune) bool {
+	return !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+}
+
+// NormalizeBlankLines walks the tree rooted at n and clamps the blank
+// lines before and after every node to at most max. The line breaks
+// starting and ending head and foot comments stand for blank lines around
+// them, and are clamped likewise, while the lines of the comments
+// themselves are left alone.
+func (n *Node) NormalizeBlankLines(max int) {
+	if max < 0 {
+		max = 0
+	}
+	if n.BlankLinesBefore > max {
+		n.BlankLinesBefore = max
+	}
+	if n.BlankLinesAfter > max {
+		n.BlankLinesAfter = max
+	}
+	n.HeadComment = clampCommentBreaks(n.HeadComment, max)
+	n.FootComment = clampCommentBreaks(n.FootComment, max)
+	if n.Kind == AliasNode {
+		return
+	}
+	for _, c := range n.Content {
+		c.NormalizeBlankLines(max)
+	}
+}
+
+// clampCommentBreaks returns comment with the runs of line breaks at its
+// start and end cut to max each.
+func clampCommentBreaks(comment string, max int) string {
+	text := strings.Trim(comment, "\n")
+	if text == "" {
+		return ""
+	}
+	lead := strings.Index(comment, text)
+	trail := len(comment) - lead - len(text)
+	if lead > max {
+		lead = max
+	}
+	if trail > max {
+		trail = max
+	}
+	return strings.Repeat("\n", lead) + text + strings.Repeat("\n", trail)
+}
+
+// RemoveBlankLines walks the tree rooted at n and removes all the blank
+// lines recorded in it. It's equivalent to NormalizeBlankLines(0).
+func (n *Node) RemoveBlankLines() {
+	n.NormalizeBlankLines(0)
+}
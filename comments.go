@@ -0,0 +1,60 @@
+package yaml
+
+// MergeComments copies the comments found in the previous tree onto the
+// nodes at the same path in the generated tree, so that documentation
+// written by hand survives the regeneration of a document.
+//
+// Mapping entries are matched by their scalar key, and sequence items by
+// their index. Comments of entries missing from the generated tree are
+// dropped, and comments already present in the generated tree are kept.
+func MergeComments(generated, previous *Node) {
+	if generated == nil || previous == nil {
+		return
+	}
+	// Either tree may be a bare value, such as one produced by Node.Encode.
+	if generated.Kind == DocumentNode && previous.Kind != DocumentNode && len(generated.Content) == 1 {
+		generated = generated.Content[0]
+	} else if previous.Kind == DocumentNode && generated.Kind != DocumentNode && len(previous.Content) == 1 {
+		mergeNodeComments(generated, previous)
+		previous = previous.Content[0]
+	}
+	mergeNodeComments(generated, previous)
+	if generated.Kind != previous.Kind {
+		return
+	}
+	switch generated.Kind {
+	case DocumentNode, SequenceNode:
+		for i := 0; i < len(generated.Content) && i < len(previous.Content); i++ {
+			MergeComments(generated.Content[i], previous.Content[i])
+		}
+	case MappingNode:
+		for i := 0; i+1 < len(generated.Content); i += 2 {
+			gk := generated.Content[i]
+			if gk.Kind != ScalarNode {
+				continue
+			}
+			for j := 0; j+1 < len(previous.Content); j += 2 {
+				pk := previous.Content[j]
+				if pk.Kind == ScalarNode && pk.Value == gk.Value {
+					mergeNodeComments(gk, pk)
+					MergeComments(generated.Content[i+1], previous.Content[j+1])
+					break
+				}
+			}
+		}
+	}
+}
+
+// mergeNodeComments copies the comments of previous which aren't set
+// in generated.
+func mergeNodeComments(generated, previous *Node) {
+	if generated.HeadComment == "" {
+		generated.HeadComment = previous.HeadComment
+	}
+	if generated.LineComment == "" {
+		generated.LineComment = previous.LineComment
+	}
+	if generated.FootComment == "" {
+		generated.FootComment = previous.FootComment
+	}
+}
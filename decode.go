@@ -21,8 +21,11 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"math/big"
+	"net/url"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -37,6 +40,13 @@ type parser struct {
 	doneInit           bool
 	textless           bool
 	preserveBlankLines bool
+
+	// source is set to record the position of scalars, as done by
+	// UnmarshalPreserving.
+	source *preservedSource
+
+	// raw is set to record the source text of scalars into RawValue.
+	raw *rawRecorder
 }
 
 func newParser(b []byte) *parser {
@@ -211,6 +221,9 @@ func (p *parser) parseChild(parent *Node) *Node {
 
 func (p *parser) document() *Node {
 	n := p.node(DocumentNode, "", "", "")
+	for _, td := range p.event.tag_directives {
+		n.TagDirectives = append(n.TagDirectives, TagDirective{Handle: string(td.handle), Prefix: string(td.prefix)})
+	}
 	p.doc = n
 	p.expect(yaml_DOCUMENT_START_EVENT)
 	p.parseChild(n)
@@ -256,7 +269,26 @@ func (p *parser) scalar() *Node {
 	}
 	n := p.node(ScalarNode, defaultTag, nodeTag, nodeValue)
 	n.Style |= nodeStyle
+	n.BlockIndent = p.event.block_indent
 	p.anchor(n, p.event.anchor)
+	if p.raw != nil {
+		start := p.event.value_start_mark
+		if start.index < p.event.start_mark.index {
+			start = p.event.start_mark
+		}
+		n.RawValue = p.raw.text(start, p.event.end_mark)
+		if nodeStyle&(LiteralStyle|FoldedStyle) != 0 {
+			// Block scalars end where the following token starts.
+			n.RawValue = strings.TrimRight(n.RawValue, " \t\r\n")
+		}
+	}
+	if p.source != nil {
+		n.source = &nodeSource{
+			src:   p.source,
+			start: p.source.offset(p.event.start_mark),
+			end:   p.source.offset(p.event.end_mark),
+		}
+	}
 	p.expect(yaml_SCALAR_EVENT)
 	return n
 }
@@ -322,21 +354,67 @@ func (p *parser) mapping() *Node {
 
 type decoder struct {
 	doc     *Node
+	root    *Node
+	parents map[*Node]*Node
 	aliases map[*Node]bool
 	terrors []string
 
 	stringMapType  reflect.Type
 	generalMapType reflect.Type
 
-	knownFields bool
-	uniqueKeys  bool
+	knownFields   bool
+	uniqueKeys    bool
+	keyNormalizer func(string) string
+	defaulter     func(field reflect.StructField) (interface{}, bool)
+
+	// discriminator selects the type to decode mappings into when these
+	// hold the discriminatorKey and are decoded into an interface.
+	discriminatorKey string
+	discriminator    func(disc string) interface{}
+
+	// registeredTypes holds the types to decode tagged values into when
+	// these are decoded into an interface.
+	registeredTypes map[string]reflect.Type
+
+	// keepUnknownTags enables decoding scalars with unknown tags into
+	// interfaces as TaggedValue.
+	keepUnknownTags bool
+
+	// decodeHooks convert scalar values before they're stored.
+	decodeHooks []decodeHook
+
+	// unwrapSingletonSeq enables decoding sequences of a single item
+	// into values which aren't collections as that item.
+	unwrapSingletonSeq bool
+
+	// leadingZeroStrings enables decoding plain numbers with leading
+	// zeros, as in 07030, as strings.
+	leadingZeroStrings bool
+
+	// timeFormats holds the layouts tried in order when decoding into
+	// time.Time values, before the !!timestamp formats.
+	timeFormats []string
+
+	// warningHandler is called with the lossy conversions made.
+	warningHandler func(Warning)
+
+	// mergeWarnings enables reporting the keys of merged mappings
+	// ignored as they're set already to warningHandler.
+	mergeWarnings bool
+
 	decodeCount int
 	aliasCount  int
 	aliasDepth  int
+	depth       int
+	stats       DecodeStats
 
 	mergedFields map[interface{}]bool
 }
 
+// decodeHook is the type of the functions added with
+// Decoder.AddDecodeHook.
+type decodeHook func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, bool, error)
+
 var (
 	nodeType       = reflect.TypeOf(Node{})
 	durationType   = reflect.TypeOf(time.Duration(0))
@@ -345,6 +423,8 @@ var (
 	ifaceType      = generalMapType.Elem()
 	timeType       = reflect.TypeOf(time.Time{})
 	ptrTimeType    = reflect.TypeOf(&time.Time{})
+	bigFloatType   = reflect.TypeOf(big.Float{})
+	urlType        = reflect.TypeOf(url.URL{})
 )
 
 func newDecoder() *decoder {
@@ -358,7 +438,9 @@ func newDecoder() *decoder {
 }
 
 func (d *decoder) terror(n *Node, tag string, out reflect.Value) {
-	if n.Tag != "" {
+	// Scalars are only decoded as strings against their tag after
+	// Decoder.SetLeadingZeroStrings, and then reported as such.
+	if n.Tag != "" && tag != strTag {
 		tag = n.Tag
 	}
 	value := n.Value
@@ -372,6 +454,37 @@ func (d *decoder) terror(n *Node, tag string, out reflect.Value) {
 	d.terrors = append(d.terrors, fmt.Sprintf("line %d: cannot unmarshal %s%s into %s", n.Line, shortTag(tag), value, out.Type()))
 }
 
+// callDecodeHooks stores into out the value converted from data by the
+// first decode hook handling it, and reports whether one did.
+func (d *decoder) callDecodeHooks(n *Node, data interface{}, out reflect.Value) (handled, good bool) {
+	for _, hook := range d.decodeHooks {
+		v, ok, err := hook(reflect.TypeOf(data), out.Type(), data)
+		if err != nil {
+			d.terrors = append(d.terrors, fmt.Sprintf("line %d: %v", n.Line, err))
+			return true, false
+		}
+		if !ok {
+			continue
+		}
+		if v == nil {
+			out.Set(reflect.Zero(out.Type()))
+			return true, true
+		}
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.Type().AssignableTo(out.Type()):
+			out.Set(rv)
+		case rv.Type().ConvertibleTo(out.Type()) && rv.Kind() != reflect.String && out.Kind() != reflect.String:
+			out.Set(rv.Convert(out.Type()))
+		default:
+			d.terrors = append(d.terrors, fmt.Sprintf("line %d: decode hook returned %s for %s", n.Line, rv.Type(), out.Type()))
+			return true, false
+		}
+		return true, true
+	}
+	return false, false
+}
+
 func (d *decoder) callUnmarshaler(n *Node, u Unmarshaler) (good bool) {
 	err := u.UnmarshalYAML(n)
 	if e, ok := err.(*TypeError); ok {
@@ -499,6 +612,9 @@ func (d *decoder) unmarshal(n *Node, out reflect.Value) (good bool) {
 	if d.aliasCount > 100 && d.decodeCount > 1000 && float64(d.aliasCount)/float64(d.decodeCount) > allowedAliasRatio(d.decodeCount) {
 		failf("document contains excessive aliasing")
 	}
+	if d.root == nil {
+		d.root = n
+	}
 	if out.Type() == nodeType {
 		out.Set(reflect.ValueOf(n).Elem())
 		return true
@@ -509,10 +625,21 @@ func (d *decoder) unmarshal(n *Node, out reflect.Value) (good bool) {
 	case AliasNode:
 		return d.alias(n, out)
 	}
+	d.stats.Nodes++
+	d.depth++
+	if d.depth > d.stats.MaxDepth {
+		d.stats.MaxDepth = d.depth
+	}
+	defer func() { d.depth-- }()
 	out, unmarshaled, good := d.prepare(n, out)
 	if unmarshaled {
 		return good
 	}
+	if out.Kind() == reflect.Interface && d.registeredTypes != nil && n.Tag != "" {
+		if t, ok := d.registeredTypes[shortTag(n.Tag)]; ok {
+			return d.registered(n, t, out)
+		}
+	}
 	switch n.Kind {
 	case ScalarNode:
 		good = d.scalar(n, out)
@@ -546,6 +673,7 @@ func (d *decoder) alias(n *Node, out reflect.Value) (good bool) {
 		failf("anchor '%s' value contains itself", n.Value)
 	}
 	d.aliases[n] = true
+	d.stats.Aliases++
 	d.aliasDepth++
 	good = d.unmarshal(n.Alias, out)
 	d.aliasDepth--
@@ -578,6 +706,9 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 	if n.indicatedString() {
 		tag = strTag
 		resolved = n.Value
+	} else if d.leadingZeroStrings && n.Style&TaggedStyle == 0 && hasLeadingZero(n.Value) {
+		tag = strTag
+		resolved = n.Value
 	} else {
 		tag, resolved = resolve(n.Tag, n.Value)
 		if tag == binaryTag {
@@ -591,11 +722,36 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 	if resolved == nil {
 		return d.null(out)
 	}
+	if len(d.decodeHooks) > 0 {
+		if handled, good := d.callDecodeHooks(n, resolved, out); handled {
+			return good
+		}
+	}
+	if d.warningHandler != nil {
+		d.checkPrecision(n, resolved, out)
+	}
+	if len(d.timeFormats) > 0 && out.Type() == timeType && (tag == strTag || tag == timestampTag) {
+		if t, ok := d.parseTime(n.Value); ok {
+			out.Set(reflect.ValueOf(t))
+			return true
+		}
+	}
 	if resolvedv := reflect.ValueOf(resolved); out.Type() == resolvedv.Type() {
 		// We've resolved to exactly the type we want, so use that.
 		out.Set(resolvedv)
 		return true
 	}
+	if out.Type() == bigFloatType && tag != binaryTag {
+		return d.bigFloat(n, resolved, out)
+	}
+	if out.Type() == urlType && tag != binaryTag {
+		u, err := url.Parse(n.Value)
+		if err != nil {
+			fail(err)
+		}
+		out.Set(reflect.ValueOf(*u))
+		return true
+	}
 	// Perhaps we can use the value as a TextUnmarshaler to
 	// set its value.
 	if out.CanAddr() {
@@ -626,6 +782,14 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 		out.SetString(n.Value)
 		return true
 	case reflect.Interface:
+		if tag == binaryTag {
+			out.Set(reflect.ValueOf([]byte(resolved.(string))))
+			return true
+		}
+		if d.keepUnknownTags && tag != "!" && tag != mergeTag && !resolvableTag(tag) {
+			out.Set(reflect.ValueOf(TaggedValue{Tag: tag, Value: n.Value}))
+			return true
+		}
 		out.Set(reflect.ValueOf(resolved))
 		return true
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -649,7 +813,8 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 				return true
 			}
 		case float64:
-			if !isDuration && resolved <= math.MaxInt64 && !out.OverflowInt(int64(resolved)) {
+			// The bounds of int64 are exact as floats, unlike its maximum.
+			if !isDuration && resolved >= math.MinInt64 && resolved < 1<<63 && !out.OverflowInt(int64(resolved)) {
 				out.SetInt(int64(resolved))
 				return true
 			}
@@ -680,7 +845,7 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 				return true
 			}
 		case float64:
-			if resolved <= math.MaxUint64 && !out.OverflowUint(uint64(resolved)) {
+			if resolved >= 0 && resolved < 1<<64 && !out.OverflowUint(uint64(resolved)) {
 				out.SetUint(uint64(resolved))
 				return true
 			}
@@ -729,6 +894,47 @@ func (d *decoder) scalar(n *Node, out reflect.Value) bool {
 	return false
 }
 
+// parseTime parses s with the layouts of timeFormats in order, and then
+// as a !!timestamp value.
+func (d *decoder) parseTime(s string) (time.Time, bool) {
+	for _, layout := range d.timeFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return parseTimestamp(s)
+}
+
+// bigFloat sets out to the big.Float value of n. Values are parsed with
+// enough precision to keep every digit, unless out already has one set.
+func (d *decoder) bigFloat(n *Node, resolved interface{}, out reflect.Value) bool {
+	if f, ok := resolved.(float64); ok && math.IsInf(f, 0) {
+		// big.Float doesn't understand the YAML spelling of infinity.
+		out.Set(reflect.ValueOf(*new(big.Float).SetInf(f < 0)))
+		return true
+	}
+	x := new(big.Float)
+	if out.CanAddr() {
+		x = out.Addr().Interface().(*big.Float)
+	}
+	if x.Prec() == 0 {
+		// Four bits per character is more than any decimal digit needs.
+		prec := uint(len(n.Value)) * 4
+		if prec < 64 {
+			prec = 64
+		}
+		x.SetPrec(prec)
+	}
+	if _, _, err := x.Parse(strings.Replace(n.Value, "_", "", -1), 0); err != nil {
+		d.terror(n, floatTag, out)
+		return false
+	}
+	if !out.CanAddr() {
+		out.Set(reflect.ValueOf(*x))
+	}
+	return true
+}
+
 func settableValueOf(i interface{}) reflect.Value {
 	v := reflect.ValueOf(i)
 	sv := reflect.New(v.Type()).Elem()
@@ -751,7 +957,15 @@ func (d *decoder) sequence(n *Node, out reflect.Value) (good bool) {
 		// No type hints. Will have to use a generic sequence.
 		iface = out
 		out = settableValueOf(make([]interface{}, l))
+	case reflect.Map:
+		if isSetType(out.Type()) {
+			return d.setSequence(n, out)
+		}
+		fallthrough
 	default:
+		if d.unwrapSingletonSeq && l == 1 {
+			return d.unmarshal(n.Content[0], out)
+		}
 		d.terror(n, seqTag, out)
 		return false
 	}
@@ -774,6 +988,30 @@ func (d *decoder) sequence(n *Node, out reflect.Value) (good bool) {
 	return true
 }
 
+// setSequence decodes the items of the sequence n as the members of the
+// set out, a map with empty struct values as encoded into a !!set.
+func (d *decoder) setSequence(n *Node, out reflect.Value) (good bool) {
+	if out.IsNil() {
+		out.Set(reflect.MakeMap(out.Type()))
+	}
+	kt := out.Type().Key()
+	present := reflect.New(out.Type().Elem()).Elem()
+	for _, item := range n.Content {
+		k := reflect.New(kt).Elem()
+		if d.unmarshal(item, k) {
+			kkind := k.Kind()
+			if kkind == reflect.Interface {
+				kkind = k.Elem().Kind()
+			}
+			if kkind == reflect.Map || kkind == reflect.Slice {
+				failf("invalid map key: %#v", k.Interface())
+			}
+			out.SetMapIndex(k, present)
+		}
+	}
+	return true
+}
+
 func (d *decoder) mapping(n *Node, out reflect.Value) (good bool) {
 	l := len(n.Content)
 	if d.uniqueKeys {
@@ -782,8 +1020,11 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (good bool) {
 			ni := n.Content[i]
 			for j := i + 2; j < l; j += 2 {
 				nj := n.Content[j]
-				if ni.Kind == nj.Kind && ni.Value == nj.Value {
-					d.terrors = append(d.terrors, fmt.Sprintf("line %d: mapping key %#v already defined at line %d", nj.Line, nj.Value, ni.Line))
+				if nodesEqual(ni, nj, false) {
+					d.terrors = append(d.terrors, fmt.Sprintf("line %d: mapping key %#v already defined at line %d", nj.Line, keyText(nj), ni.Line))
+				} else if d.keyNormalizer != nil && ni.Kind == ScalarNode && nj.Kind == ScalarNode &&
+					d.keyNormalizer(ni.Value) == d.keyNormalizer(nj.Value) {
+					d.terrors = append(d.terrors, fmt.Sprintf("line %d: mapping key %#v collides with key %#v at line %d once normalized", nj.Line, nj.Value, ni.Value, ni.Line))
 				}
 			}
 		}
@@ -797,6 +1038,11 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (good bool) {
 	case reflect.Map:
 		// okay
 	case reflect.Interface:
+		if d.discriminator != nil {
+			if good, ok := d.discriminate(n, out); ok {
+				return good
+			}
+		}
 		iface := out
 		if isStringMap(n) {
 			out = reflect.MakeMap(d.stringMapType)
@@ -840,9 +1086,12 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (good bool) {
 		}
 		k := reflect.New(kt).Elem()
 		if d.unmarshal(n.Content[i], k) {
+			binaryKeyAsString(k)
+			d.normalizeKey(k)
 			if mergedFields != nil {
 				ki := k.Interface()
 				if mergedFields[ki] {
+					d.warnMerged(n.Content[i])
 					continue
 				}
 				mergedFields[ki] = true
@@ -871,6 +1120,65 @@ func (d *decoder) mapping(n *Node, out reflect.Value) (good bool) {
 	return true
 }
 
+// keyText returns the text of the mapping key n for error messages,
+// with sequences and mappings written in flow style.
+func keyText(n *Node) string {
+	switch n.Kind {
+	case SequenceNode, MappingNode:
+		var b strings.Builder
+		if n.Kind == SequenceNode {
+			b.WriteByte('[')
+		} else {
+			b.WriteByte('{')
+		}
+		for i, c := range n.Content {
+			if i > 0 {
+				if n.Kind == MappingNode && i%2 == 1 {
+					b.WriteString(": ")
+				} else {
+					b.WriteString(", ")
+				}
+			}
+			b.WriteString(keyText(c))
+		}
+		if n.Kind == SequenceNode {
+			b.WriteByte(']')
+		} else {
+			b.WriteByte('}')
+		}
+		return b.String()
+	case AliasNode:
+		return "*" + n.Value
+	}
+	return n.Value
+}
+
+// binaryKeyAsString turns binary data decoded into the interface k into a
+// string, as a []byte can't be used as a map key.
+func binaryKeyAsString(k reflect.Value) {
+	if k.Kind() == reflect.Interface {
+		if b, ok := k.Interface().([]byte); ok {
+			k.Set(reflect.ValueOf(string(b)))
+		}
+	}
+}
+
+// normalizeKey applies the key normalizer, if any, to the decoded
+// mapping key k when it holds a string.
+func (d *decoder) normalizeKey(k reflect.Value) {
+	if d.keyNormalizer == nil {
+		return
+	}
+	switch k.Kind() {
+	case reflect.String:
+		k.SetString(d.keyNormalizer(k.String()))
+	case reflect.Interface:
+		if s, ok := k.Interface().(string); ok {
+			k.Set(reflect.ValueOf(d.keyNormalizer(s)))
+		}
+	}
+}
+
 func isStringMap(n *Node) bool {
 	if n.Kind != MappingNode {
 		return false
@@ -905,11 +1213,23 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (good bool) {
 
 	mergedFields := d.mergedFields
 	d.mergedFields = nil
+	if sinfo.NodeField != -1 && mergedFields == nil {
+		field := out.Field(sinfo.NodeField)
+		if field.Kind() == reflect.Ptr {
+			field.Set(reflect.ValueOf(n))
+		} else {
+			field.Set(reflect.ValueOf(*n))
+		}
+	}
 	var mergeNode *Node
 	var doneFields []bool
 	if d.uniqueKeys {
 		doneFields = make([]bool, len(sinfo.FieldsList))
 	}
+	var present map[interface{}]bool
+	if d.defaulter != nil && mergedFields == nil {
+		present = make(map[interface{}]bool)
+	}
 	name := settableValueOf("")
 	l := len(n.Content)
 	for i := 0; i < l; i += 2 {
@@ -921,9 +1241,23 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (good bool) {
 		if !d.unmarshal(ni, name) {
 			continue
 		}
+		d.normalizeKey(name)
 		sname := name.String()
+		if key, ok := sinfo.Aliases[sname]; ok {
+			if d.hasKey(n, key) {
+				if d.warningHandler != nil {
+					d.warn(ni, "key %q ignored as %q is also set", sname, key)
+				}
+				continue
+			}
+			sname = key
+		}
+		if present != nil {
+			present[sname] = true
+		}
 		if mergedFields != nil {
 			if mergedFields[sname] {
+				d.warnMerged(ni)
 				continue
 			}
 			mergedFields[sname] = true
@@ -942,7 +1276,13 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (good bool) {
 			} else {
 				field = d.fieldByIndex(n, out, info.Inline)
 			}
-			d.unmarshal(n.Content[i+1], field)
+			if info.Bytes {
+				d.byteSize(n.Content[i+1], field)
+			} else if info.Epoch != 0 {
+				d.epoch(n.Content[i+1], field, info.Epoch)
+			} else {
+				d.unmarshal(n.Content[i+1], field)
+			}
 		} else if sinfo.InlineMap != -1 {
 			if inlineMap.IsNil() {
 				inlineMap.Set(reflect.MakeMap(inlineMap.Type()))
@@ -957,8 +1297,330 @@ func (d *decoder) mappingStruct(n *Node, out reflect.Value) (good bool) {
 
 	d.mergedFields = mergedFields
 	if mergeNode != nil {
+		if present != nil {
+			// Have the merged mappings record the fields they set.
+			d.mergedFields = present
+		}
 		d.merge(n, mergeNode, out)
+		d.mergedFields = mergedFields
+	}
+	if present != nil {
+		d.setDefaults(n, sinfo, out, present)
+	}
+	if mergedFields == nil {
+		d.validate(n, out)
+	}
+	return true
+}
+
+// hasKey reports whether the mapping n holds a scalar key equal to key
+// once normalized.
+func (d *decoder) hasKey(n *Node, key string) bool {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k := n.Content[i]
+		if k.Kind != ScalarNode {
+			continue
+		}
+		value := k.Value
+		if d.keyNormalizer != nil {
+			value = d.keyNormalizer(value)
+		}
+		if value == key {
+			return true
+		}
+	}
+	return false
+}
+
+// validate calls the ValidateYAML method of out, if it implements
+// Validator, failing with the error it may return.
+func (d *decoder) validate(n *Node, out reflect.Value) {
+	var v Validator
+	if out.CanAddr() {
+		v, _ = out.Addr().Interface().(Validator)
+	}
+	if v == nil {
+		v, _ = out.Interface().(Validator)
+	}
+	if v == nil {
+		return
+	}
+	path := d.nodePath(n)
+	if err := v.ValidateYAML(path); err != nil {
+		fail(&ValidationError{Path: path, Line: n.Line, Column: n.Column, Err: err})
+	}
+}
+
+// hasLeadingZero reports whether s is a number written with a zero before
+// further digits, as in "07030" or "-00.5".
+func hasLeadingZero(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	if len(s) < 2 || s[0] != '0' || !(s[1] >= '0' && s[1] <= '9' || s[1] == '_') {
+		return false
+	}
+	tag, _ := resolve("", s)
+	return tag == intTag || tag == floatTag
+}
+
+// warn reports a lossy conversion made when decoding n to the function
+// set with Decoder.SetWarningHandler.
+func (d *decoder) warn(n *Node, format string, args ...interface{}) {
+	d.warningHandler(Warning{
+		Path:    d.nodePath(n),
+		Line:    n.Line,
+		Column:  n.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// checkPrecision warns when the number n resolved to has more significant
+// digits than the floating point value it's decoded into can hold.
+func (d *decoder) checkPrecision(n *Node, resolved interface{}, out reflect.Value) {
+	bits := 64
+	switch out.Kind() {
+	case reflect.Float32:
+		bits = 32
+	case reflect.Float64:
+	case reflect.Interface:
+		// Only floats are decoded into interfaces as floating point.
+		if _, ok := resolved.(float64); !ok {
+			return
+		}
+	default:
+		return
+	}
+	var text string
+	var f float64
+	switch r := resolved.(type) {
+	case float64:
+		if math.IsInf(r, 0) || math.IsNaN(r) {
+			return
+		}
+		text, f = n.Value, r
+	case int:
+		text, f = strconv.Itoa(r), float64(r)
+	case int64:
+		text, f = strconv.FormatInt(r, 10), float64(r)
+	case uint64:
+		text, f = strconv.FormatUint(r, 10), float64(r)
+	default:
+		return
+	}
+	if bits == 32 {
+		f = float64(float32(f))
+	}
+	if significantDigits(text) != significantDigits(strconv.FormatFloat(f, 'e', -1, bits)) {
+		d.warn(n, "%s loses precision as float%d", n.Value, bits)
+	}
+}
+
+// significantDigits returns the digits of the number written in s without
+// its exponent, sign, decimal point or leading and trailing zeros.
+func significantDigits(s string) string {
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	return strings.Trim(s, "0")
+}
+
+// nodePath returns the path of n within the tree being decoded, in the
+// form described by Validator.
+func (d *decoder) nodePath(n *Node) string {
+	if d.parents == nil {
+		d.parents = make(map[*Node]*Node)
+		var walk func(n *Node)
+		walk = func(n *Node) {
+			for _, c := range n.Content {
+				d.parents[c] = n
+				walk(c)
+			}
+		}
+		walk(d.root)
+	}
+	var path []string
+	for parent := d.parents[n]; parent != nil; n, parent = parent, d.parents[parent] {
+		i := 0
+		for parent.Content[i] != n {
+			i++
+		}
+		switch parent.Kind {
+		case SequenceNode:
+			path = append(path, "["+strconv.Itoa(i)+"]")
+		case MappingNode:
+			path = append(path, parent.Content[i&^1].Value)
+		}
+	}
+	var b strings.Builder
+	for i := len(path) - 1; i >= 0; i-- {
+		if b.Len() > 0 && !strings.HasPrefix(path[i], "[") {
+			b.WriteByte('.')
+		}
+		b.WriteString(path[i])
 	}
+	return b.String()
+}
+
+// setDefaults asks the defaulter for the value of every field of out
+// whose key wasn't found in the mapping n.
+func (d *decoder) setDefaults(n *Node, sinfo *structInfo, out reflect.Value, present map[interface{}]bool) {
+	for _, info := range sinfo.FieldsList {
+		if present[info.Key] {
+			continue
+		}
+		var sf reflect.StructField
+		if info.Inline == nil {
+			sf = out.Type().Field(info.Num)
+		} else {
+			sf = out.Type().FieldByIndex(info.Inline)
+		}
+		v, ok := d.defaulter(sf)
+		if !ok {
+			continue
+		}
+		var field reflect.Value
+		if info.Inline == nil {
+			field = out.Field(info.Num)
+		} else {
+			field = d.fieldByIndex(n, out, info.Inline)
+		}
+		if v == nil {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+		rv := reflect.ValueOf(v)
+		switch {
+		case rv.Type().AssignableTo(field.Type()):
+			field.Set(rv)
+		case rv.Type().ConvertibleTo(field.Type()) && rv.Kind() != reflect.String && field.Kind() != reflect.String:
+			field.Set(rv.Convert(field.Type()))
+		default:
+			d.terrors = append(d.terrors, fmt.Sprintf("line %d: cannot use default %#v of type %s for field %s of type %s", n.Line, v, rv.Type(), sf.Name, field.Type()))
+		}
+	}
+}
+
+// discriminate decodes the entries of the mapping n other than its
+// discriminator key into a value of the type selected for it, and stores
+// that value into the interface out. It returns false in ok when n has no
+// such key or no type was selected for it.
+func (d *decoder) discriminate(n *Node, out reflect.Value) (good, ok bool) {
+	var disc *Node
+	rest := make([]*Node, 0, len(n.Content))
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if disc == nil && k.Kind == ScalarNode && k.Value == d.discriminatorKey && v.Kind == ScalarNode {
+			disc = v
+			continue
+		}
+		rest = append(rest, k, v)
+	}
+	if disc == nil {
+		return false, false
+	}
+	proto := d.discriminator(disc.Value)
+	if proto == nil {
+		return false, false
+	}
+	v := reflect.New(reflect.TypeOf(proto)).Elem()
+	if !v.Type().AssignableTo(out.Type()) {
+		d.terrors = append(d.terrors, fmt.Sprintf("line %d: cannot unmarshal %s %s into %s", disc.Line, d.discriminatorKey, disc.Value, out.Type()))
+		return false, true
+	}
+	target := v
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		target = v.Elem()
+	}
+	m := *n
+	m.Content = rest
+	good = d.unmarshal(&m, target)
+	out.Set(v)
+	return good, true
+}
+
+// registered decodes n, ignoring its tag, into a new value of the type t
+// registered for that tag, and stores that value into the interface out.
+func (d *decoder) registered(n *Node, t reflect.Type, out reflect.Value) (good bool) {
+	v := reflect.New(t).Elem()
+	if !t.AssignableTo(out.Type()) {
+		d.terrors = append(d.terrors, fmt.Sprintf("line %d: cannot unmarshal %s into %s as %s", n.Line, n.ShortTag(), out.Type(), t))
+		return false
+	}
+	target := v
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(t.Elem()))
+		target = v.Elem()
+	}
+	m := *n
+	m.Tag = ""
+	m.Style &^= TaggedStyle
+	good = d.unmarshal(&m, target)
+	out.Set(v)
+	return good
+}
+
+// byteSize decodes a size in bytes such as "256Mi" from n into the
+// integer out, for fields with the bytes flag.
+func (d *decoder) byteSize(n *Node, out reflect.Value) (good bool) {
+	if n.Kind != ScalarNode || n.ShortTag() == nullTag {
+		return d.unmarshal(n, out)
+	}
+	for out.Kind() == reflect.Ptr {
+		if out.IsNil() {
+			out.Set(reflect.New(out.Type().Elem()))
+		}
+		out = out.Elem()
+	}
+	if size, ok := parseByteSize(n.Value); ok {
+		switch out.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if size.IsInt64() && !out.OverflowInt(size.Int64()) {
+				out.SetInt(size.Int64())
+				return true
+			}
+		default:
+			if size.IsUint64() && !out.OverflowUint(size.Uint64()) {
+				out.SetUint(size.Uint64())
+				return true
+			}
+		}
+	}
+	d.terror(n, n.ShortTag(), out)
+	return false
+}
+
+// epoch decodes an integer number of units since the Unix epoch from n
+// into the time.Time out, for fields with the unix or unixmilli flags.
+// Other values are decoded as usual.
+func (d *decoder) epoch(n *Node, out reflect.Value, unit time.Duration) (good bool) {
+	if n.Kind != ScalarNode || n.ShortTag() != intTag {
+		return d.unmarshal(n, out)
+	}
+	var v int64
+	if !d.unmarshal(n, reflect.ValueOf(&v).Elem()) {
+		return false
+	}
+	for out.Kind() == reflect.Ptr {
+		if out.IsNil() {
+			out.Set(reflect.New(out.Type().Elem()))
+		}
+		out = out.Elem()
+	}
+	var t time.Time
+	if unit == time.Second {
+		t = time.Unix(v, 0)
+	} else {
+		t = time.UnixMilli(v)
+	}
+	out.Set(reflect.ValueOf(t.UTC()))
 	return true
 }
 
@@ -973,6 +1635,8 @@ func (d *decoder) merge(parent *Node, merge *Node, out reflect.Value) {
 		for i := 0; i < len(parent.Content); i += 2 {
 			k := reflect.New(ifaceType).Elem()
 			if d.unmarshal(parent.Content[i], k) {
+				binaryKeyAsString(k)
+				d.normalizeKey(k)
 				d.mergedFields[k.Interface()] = true
 			}
 		}
@@ -1005,6 +1669,14 @@ func (d *decoder) merge(parent *Node, merge *Node, out reflect.Value) {
 	d.mergedFields = mergedFields
 }
 
+// warnMerged warns about the key of a merged mapping ignored as it's set
+// already, when enabled.
+func (d *decoder) warnMerged(key *Node) {
+	if d.mergeWarnings && d.warningHandler != nil {
+		d.warn(key, "merged key %q ignored as it's set already", key.Value)
+	}
+}
+
 func isMerge(n *Node) bool {
 	return n.Kind == ScalarNode && n.Value == "<<" && (n.Tag == "" || n.Tag == "!" || shortTag(n.Tag) == mergeTag)
 }
@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -219,6 +221,18 @@ var unmarshalTests = []struct {
 	}, {
 		"seq: [A,1,C]",
 		map[string]interface{}{"seq": []interface{}{"A", 1, "C"}},
+	}, {
+		"seq: [a long\n  wrapped value, b]",
+		map[string][]string{"seq": []string{"a long wrapped value", "b"}},
+	}, {
+		"seq: [a\n\n  b,\n  c \t\n  d\n  ]",
+		map[string][]string{"seq": []string{"a\nb", "c d"}},
+	}, {
+		"seq: [is it\n  ?really, a?b]",
+		map[string][]string{"seq": []string{"is it ?really", "a?b"}},
+	}, {
+		"map: {a: wrapped\n  - value, b?: c}",
+		map[string]map[string]string{"map": {"a": "wrapped - value", "b?": "c"}},
 	},
 	// Block sequence
 	{
@@ -618,6 +632,26 @@ var unmarshalTests = []struct {
 		map[string]time.Duration{"a": 3 * time.Second},
 	},
 
+	// Sizes in bytes
+	{
+		"memory: 256Mi\ndisk: 1.5G\nlimit: 42\nquota: 2Ki",
+		&struct {
+			Memory int    ",bytes"
+			Disk   uint64 ",bytes"
+			Limit  int32  ",bytes"
+			Quota  *int   ",bytes"
+		}{268435456, 1500000000, 42, &[]int{2048}[0]},
+	},
+
+	// Sets
+	{
+		"!!set {a, b, c}",
+		map[string]struct{}{"a": {}, "b": {}, "c": {}},
+	}, {
+		"s: !!set\n  ? 1\n  ? 2\n",
+		map[string]map[int]struct{}{"s": {1: {}, 2: {}}},
+	},
+
 	// Issue #24.
 	{
 		"a: <foo>",
@@ -640,6 +674,21 @@ var unmarshalTests = []struct {
 	}, {
 		"a: !!binary |\n  " + strings.Repeat("A", 70) + "\n  ==\n",
 		map[string]string{"a": strings.Repeat("\x00", 52)},
+	}, {
+		"a: !!binary gIGC\n",
+		map[string]interface{}{"a": []byte("\x80\x81\x82")},
+	}, {
+		"- !!binary gIGC\n",
+		[]interface{}{[]byte("\x80\x81\x82")},
+	}, {
+		"!!binary gIGC: a\n",
+		map[interface{}]interface{}{"\x80\x81\x82": "a"},
+	}, {
+		"b: &b {!!binary gIGC: a}\nc:\n  <<: *b\n  !!binary gIGC: b\n",
+		map[string]interface{}{
+			"b": map[interface{}]interface{}{"\x80\x81\x82": "a"},
+			"c": map[interface{}]interface{}{"\x80\x81\x82": "b"},
+		},
 	},
 
 	// Issue #39.
@@ -833,6 +882,429 @@ func (s *S) TestUnmarshal(c *C) {
 	}
 }
 
+func (s *S) TestUnixTimeFields(c *C) {
+	type T struct {
+		Created time.Time  `yaml:"created,unix"`
+		Updated *time.Time `yaml:"updated,unixmilli"`
+		Expires time.Time  `yaml:"expires,unix,omitempty"`
+	}
+	var v T
+	err := yaml.Unmarshal([]byte("created: 1600000000\nupdated: 1600000000123\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v.Created, Equals, time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC))
+	c.Assert(*v.Updated, Equals, time.Date(2020, 9, 13, 12, 26, 40, 123e6, time.UTC))
+	c.Assert(v.Expires.IsZero(), Equals, true)
+
+	out, err := yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "created: 1600000000\nupdated: 1600000000123\n")
+	var back T
+	c.Assert(yaml.Unmarshal(out, &back), IsNil)
+	c.Assert(back, DeepEquals, v)
+
+	// Timestamps and nulls are still accepted.
+	v = T{}
+	err = yaml.Unmarshal([]byte("created: 2020-09-13T12:26:40Z\nupdated: ~\n"), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v.Created, Equals, time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC))
+	c.Assert(v.Updated, IsNil)
+	out, err = yaml.Marshal(&v)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "created: 1600000000\nupdated: null\n")
+
+	err = yaml.Unmarshal([]byte("created: soon\n"), &v)
+	c.Assert(err, ErrorMatches, `parsing time "soon" .*`)
+
+	var bad struct {
+		At int64 `yaml:"at,unix"`
+	}
+	c.Assert(func() { yaml.Unmarshal([]byte("at: 1"), &bad) }, PanicMatches, "options ,unix and ,unixmilli need a time.Time field in struct .*")
+}
+
+func (s *S) TestAliasedFields(c *C) {
+	type T struct {
+		Timeout int               `yaml:"timeout,alias=timeout_secs,alias=wait"`
+		Labels  map[string]string `yaml:"labels,alias=tags"`
+	}
+	tests := []struct {
+		data string
+		want T
+	}{
+		{"timeout_secs: 5\ntags: {a: 1}\n", T{Timeout: 5, Labels: map[string]string{"a": "1"}}},
+		{"wait: 6\n", T{Timeout: 6}},
+		{"timeout: 7\nlabels: {b: 2}\n", T{Timeout: 7, Labels: map[string]string{"b": "2"}}},
+		{"timeout_secs: 5\ntimeout: 7\ntags: {a: 1}\nlabels: {b: 2}\n", T{Timeout: 7, Labels: map[string]string{"b": "2"}}},
+		{"timeout: 7\ntimeout_secs: 5\nlabels: {b: 2}\ntags: {a: 1}\n", T{Timeout: 7, Labels: map[string]string{"b": "2"}}},
+	}
+	for _, test := range tests {
+		var v T
+		c.Assert(yaml.Unmarshal([]byte(test.data), &v), IsNil)
+		c.Assert(v, DeepEquals, test.want, Commentf("data: %q", test.data))
+	}
+
+	// Aliases are never used when marshaling.
+	out, err := yaml.Marshal(&T{Timeout: 5})
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "timeout: 5\nlabels: {}\n")
+
+	// Aliases don't count as unknown fields either.
+	dec := yaml.NewDecoder(strings.NewReader("timeout_secs: 5\n"))
+	dec.KnownFields(true)
+	var v T
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.Timeout, Equals, 5)
+
+	var bad struct {
+		A int `yaml:"a"`
+		B int `yaml:"b,alias=a"`
+	}
+	c.Assert(func() { yaml.Unmarshal([]byte("a: 1"), &bad) }, PanicMatches, "alias 'a' conflicts with a key in struct .*")
+}
+
+func (s *S) TestDecoderKeepUnknownTags(c *C) {
+	data := "a: !!unknown foo\nb: !color 'dark red'\nc: !!str 1\nd: !!int 3\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetKeepUnknownTags(true)
+	var v map[string]interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{
+		"a": yaml.TaggedValue{Tag: "!!unknown", Value: "foo"},
+		"b": yaml.TaggedValue{Tag: "!color", Value: "dark red"},
+		"c": "1",
+		"d": 3,
+	})
+
+	out, err := yaml.Marshal(map[string]interface{}{"a": v["a"], "b": v["b"]})
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "a: !!unknown foo\nb: !color dark red\n")
+
+	// Other types still get the text.
+	var t struct{ A string }
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetKeepUnknownTags(true)
+	c.Assert(dec.Decode(&t), IsNil)
+	c.Assert(t.A, Equals, "foo")
+
+	// The tag is dropped by default.
+	v = nil
+	c.Assert(yaml.Unmarshal([]byte(data), &v), IsNil)
+	c.Assert(v["a"], Equals, "foo")
+}
+
+func (s *S) TestUnmarshalComplexKeys(c *C) {
+	data := "? [1, 2]\n: a\n? - 3\n  - 4\n: b\n"
+	var m map[[2]int]string
+	c.Assert(yaml.Unmarshal([]byte(data), &m), IsNil)
+	c.Assert(m, DeepEquals, map[[2]int]string{{1, 2}: "a", {3, 4}: "b"})
+
+	type point struct{ X, Y int }
+	var p map[point]string
+	c.Assert(yaml.Unmarshal([]byte("{x: 1, y: 2}: a\n"), &p), IsNil)
+	c.Assert(p, DeepEquals, map[point]string{{1, 2}: "a"})
+
+	// Nodes keep the keys as they are.
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(data), &n), IsNil)
+	key := n.Content[0].Content[2]
+	c.Assert(key.Kind, Equals, yaml.SequenceNode)
+	c.Assert(key.Content, HasLen, 2)
+	c.Assert(key.Content[1].Value, Equals, "4")
+	out, err := yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "? [1, 2]\n: a\n?   - 3\n    - 4\n: b\n")
+	m = nil
+	c.Assert(yaml.Unmarshal(out, &m), IsNil)
+	c.Assert(m, DeepEquals, map[[2]int]string{{1, 2}: "a", {3, 4}: "b"})
+
+	var wrongType map[string]string
+	c.Assert(yaml.Unmarshal([]byte(data), &wrongType), ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: cannot unmarshal !!seq into string\n"+
+		"  line 3: cannot unmarshal !!seq into string")
+	var wrongLen map[[3]int]string
+	c.Assert(yaml.Unmarshal([]byte(data), &wrongLen), ErrorMatches, "yaml: invalid array: want 3 elements but got 2")
+	var iface map[interface{}]string
+	c.Assert(yaml.Unmarshal([]byte(data), &iface), ErrorMatches, `yaml: invalid map key: \[\]interface \{\}\{1, 2\}`)
+
+	// Keys with the same content are duplicates.
+	err = yaml.Unmarshal([]byte("? [1, {a: b}]\n: a\n? [1, {a: c}]\n: b\n? [1, {a: b}]\n: c\n"), &m)
+	c.Assert(err, ErrorMatches, `yaml: unmarshal errors:\n  line 5: mapping key "\[1, {a: b}\]" already defined at line 1`)
+}
+
+func (s *S) TestDecoderUnwrapSingletonSeq(c *C) {
+	type T struct {
+		Items  string   `yaml:"items"`
+		Port   int      `yaml:"port"`
+		Hosts  []string `yaml:"hosts"`
+		Server struct {
+			Name string `yaml:"name"`
+		} `yaml:"server"`
+	}
+	data := "items: [x]\nport:\n  - 80\nhosts: [a]\nserver: [{name: web}]\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetUnwrapSingletonSeq(true)
+	var v T
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.Items, Equals, "x")
+	c.Assert(v.Port, Equals, 80)
+	c.Assert(v.Hosts, DeepEquals, []string{"a"})
+	c.Assert(v.Server.Name, Equals, "web")
+
+	dec = yaml.NewDecoder(strings.NewReader("items: [x, y]\n"))
+	dec.SetUnwrapSingletonSeq(true)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!seq into string")
+
+	v = T{}
+	c.Assert(yaml.Unmarshal([]byte("items: [x]\n"), &v), ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!seq into string")
+}
+
+func (s *S) TestValid(c *C) {
+	for _, data := range []string{
+		"",
+		"a: 1\nb: [x, {y: z}]\n",
+		"--- &a x\n--- *a\n",
+		"a: &x 1\nb: *x\n",
+		"a: |\n  text\n# comment\n",
+	} {
+		c.Assert(yaml.Valid([]byte(data)), IsNil, Commentf("%q", data))
+	}
+	for _, t := range []struct{ data, error string }{
+		{"a: [1, 2\n", "yaml: line 1: did not find expected ',' or ']'"},
+		{"a: 1\nb: 2\n  c: 3\n", "yaml: line 3: mapping values are not allowed in this context"},
+		{"a: 1\nb: c: d\n", "yaml: line 2: mapping values are not allowed in this context"},
+		{"a: 'x\n", "yaml: line 2: found unexpected end of stream"},
+		{"a: *x\n", "yaml: line 1: unknown anchor 'x' referenced"},
+		{"a: &x 1\n---\nb: *x\nc: *y\n", "yaml: line 4: unknown anchor 'y' referenced"},
+	} {
+		c.Assert(yaml.Valid([]byte(t.data)), ErrorMatches, t.error, Commentf("%q", t.data))
+	}
+}
+
+func (s *S) TestDecoderLenientEscapes(c *C) {
+	data := `a: "\q"` + "\n" + `b: "C:\Temp\é\n"` + "\n" + `c: "tab\there \\q"` + "\n"
+	var v map[string]string
+	err := yaml.Unmarshal([]byte(data), &v)
+	c.Assert(err, ErrorMatches, "yaml: found unknown escape character")
+
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetLenientEscapes(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]string{
+		"a": `\q`,
+		"b": `C:\Temp\é` + "\n",
+		"c": "tab\there \\q",
+	})
+
+	// Settings are kept across resets, and malformed escapes still fail.
+	dec.Reset(strings.NewReader(`["\q", "\x4"]`))
+	var l []string
+	c.Assert(dec.Decode(&l), ErrorMatches, "yaml: did not find expected hexdecimal number")
+	dec.Reset(strings.NewReader(`["\q", '\q']`))
+	c.Assert(dec.Decode(&l), IsNil)
+	c.Assert(l, DeepEquals, []string{`\q`, `\q`})
+}
+
+func (s *S) TestDecoderTimeFormats(c *C) {
+	data := "date: \"2024-03-01\"\nstamp: 2024-03-01 12:30:45\nquoted: \"2024-03-01 12:30:45\"\nlocal: 01/03/2024\nzoned: 2024-03-01T12:30:45+02:00\n"
+	var v struct {
+		Date   time.Time
+		Stamp  time.Time
+		Quoted time.Time
+		Local  *time.Time
+		Zoned  time.Time
+	}
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetTimeFormats("02/01/2006", "2006-01-02 15:04:05")
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.Date, DeepEquals, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	c.Assert(v.Stamp, DeepEquals, time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC))
+	c.Assert(v.Quoted, DeepEquals, time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC))
+	c.Assert(*v.Local, DeepEquals, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+	c.Assert(v.Zoned.Equal(time.Date(2024, 3, 1, 10, 30, 45, 0, time.UTC)), Equals, true)
+
+	// Values matching none of the formats fail as before.
+	dec = yaml.NewDecoder(strings.NewReader("date: tomorrow\n"))
+	dec.SetTimeFormats("02/01/2006")
+	c.Assert(dec.Decode(&v), ErrorMatches, `parsing time "tomorrow".*`)
+
+	// Other types aren't affected.
+	var m map[string]interface{}
+	dec = yaml.NewDecoder(strings.NewReader("local: 01/03/2024\n"))
+	dec.SetTimeFormats("02/01/2006")
+	c.Assert(dec.Decode(&m), IsNil)
+	c.Assert(m["local"], Equals, "01/03/2024")
+
+	// Without formats, quoted strings only decode as RFC 3339.
+	c.Assert(yaml.Unmarshal([]byte("date: \"2024-03-01\"\n"), &v), ErrorMatches, `parsing time "2024-03-01".*`)
+}
+
+func (s *S) TestDecoderLeadingZeroStrings(c *C) {
+	data := "zipcode: 07030\nneg: -0123\nzeros: 00\nfloat: 01.50\nzero: 0\nhalf: 0.5\nhex: 0x1F\noctal: 0o17\ntagged: !!int 0755\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetLeadingZeroStrings(true)
+	var v map[string]interface{}
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{
+		"zipcode": "07030",
+		"neg":     "-0123",
+		"zeros":   "00",
+		"float":   "01.50",
+		"zero":    0,
+		"half":    0.5,
+		"hex":     31,
+		"octal":   15,
+		"tagged":  493,
+	})
+
+	// The strings are kept through a round trip.
+	out, err := yaml.Marshal(v)
+	c.Assert(err, IsNil)
+	dec = yaml.NewDecoder(bytes.NewReader(out))
+	dec.SetLeadingZeroStrings(true)
+	var back map[string]interface{}
+	c.Assert(dec.Decode(&back), IsNil)
+	c.Assert(back, DeepEquals, v)
+
+	// Nodes keep the text as written.
+	var n yaml.Node
+	dec = yaml.NewDecoder(strings.NewReader("zipcode: 07030\n"))
+	dec.SetLeadingZeroStrings(true)
+	c.Assert(dec.Decode(&n), IsNil)
+	out, err = yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "zipcode: 07030\n")
+
+	var t struct{ Zipcode int }
+	dec = yaml.NewDecoder(strings.NewReader("zipcode: 07030\n"))
+	dec.SetLeadingZeroStrings(true)
+	c.Assert(dec.Decode(&t), ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!str `07030` into int")
+
+	v = nil
+	c.Assert(yaml.Unmarshal([]byte("zipcode: 07030\n"), &v), IsNil)
+	c.Assert(v["zipcode"], Equals, 3608)
+}
+
+func (s *S) TestDecoderSetWarningHandler(c *C) {
+	type T struct {
+		Pi     float64     `yaml:"pi"`
+		Ratio  float32     `yaml:"ratio"`
+		Tenth  float32     `yaml:"tenth"`
+		Big    float64     `yaml:"big"`
+		Exact  float64     `yaml:"exact"`
+		Any    interface{} `yaml:"any"`
+		Name   string      `yaml:"name,alias=title"`
+		Values []float64   `yaml:"values"`
+	}
+	data := "" +
+		"pi: 3.14159265358979323846\n" +
+		"ratio: 0.123456789\n" +
+		"tenth: 0.1\n" +
+		"big: 9007199254740993\n" +
+		"exact: 1_000.50e2\n" +
+		"any: 2.7182818284590452354\n" +
+		"name: a\n" +
+		"title: b\n" +
+		"values: [1.5, 0.30000000000000001]\n"
+	var warnings []yaml.Warning
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetWarningHandler(func(w yaml.Warning) {
+		warnings = append(warnings, w)
+	})
+	var v T
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.Pi, Equals, math.Pi)
+	c.Assert(v.Name, Equals, "a")
+	c.Assert(warnings, DeepEquals, []yaml.Warning{
+		{Path: "pi", Line: 1, Column: 5, Message: "3.14159265358979323846 loses precision as float64"},
+		{Path: "ratio", Line: 2, Column: 8, Message: "0.123456789 loses precision as float32"},
+		{Path: "big", Line: 4, Column: 6, Message: "9007199254740993 loses precision as float64"},
+		{Path: "any", Line: 6, Column: 6, Message: "2.7182818284590452354 loses precision as float64"},
+		{Path: "title", Line: 8, Column: 1, Message: `key "title" ignored as "name" is also set`},
+		{Path: "values[1]", Line: 9, Column: 15, Message: "0.30000000000000001 loses precision as float64"},
+	})
+	c.Assert(warnings[0].String(), Equals, "line 1: pi: 3.14159265358979323846 loses precision as float64")
+
+	// Without a handler, lossy conversions are silent.
+	v = T{}
+	c.Assert(yaml.Unmarshal([]byte(data), &v), IsNil)
+	c.Assert(v.Pi, Equals, math.Pi)
+}
+
+func (s *S) TestDecoderMergePrecedence(c *C) {
+	data := "" +
+		"a: &a {x: a, y: a, z: a}\n" +
+		"b: &b {x: b, y: b, w: b}\n" +
+		"c: &c {<<: *b, v: c, y: c}\n" +
+		"m1:\n" +
+		"  <<: [*a, *b]\n" +
+		"  x: local\n" +
+		"m2:\n" +
+		"  x: local\n" +
+		"  <<: [*b, *a]\n" +
+		"m3:\n" +
+		"  <<: [*c, *a]\n"
+	want := map[string]map[string]string{
+		"m1": {"x": "local", "y": "a", "z": "a", "w": "b"},
+		"m2": {"x": "local", "y": "b", "z": "a", "w": "b"},
+		"m3": {"x": "b", "y": "c", "z": "a", "w": "b", "v": "c"},
+	}
+
+	var m map[string]map[string]string
+	c.Assert(yaml.Unmarshal([]byte(data), &m), IsNil)
+	for k, v := range want {
+		c.Assert(m[k], DeepEquals, v, Commentf("%s", k))
+	}
+
+	type T struct{ X, Y, Z, W, V string }
+	var st map[string]T
+	c.Assert(yaml.Unmarshal([]byte(data), &st), IsNil)
+	for k, v := range want {
+		c.Assert(st[k], DeepEquals, T{X: v["x"], Y: v["y"], Z: v["z"], W: v["w"], V: v["v"]}, Commentf("%s", k))
+	}
+
+	var warnings []string
+	dec := yaml.NewDecoder(strings.NewReader("a: &a {x: a, y: a}\nb: &b {x: b, w: b}\nm:\n  <<: [*a, *b]\n  y: local\n"))
+	dec.SetWarningHandler(func(w yaml.Warning) {
+		warnings = append(warnings, w.String())
+	})
+	dec.SetMergeWarnings(true)
+	var v map[string]map[string]string
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v["m"], DeepEquals, map[string]string{"x": "a", "y": "local", "w": "b"})
+	c.Assert(warnings, DeepEquals, []string{
+		`line 1: a.y: merged key "y" ignored as it's set already`,
+		`line 2: b.x: merged key "x" ignored as it's set already`,
+	})
+}
+
+func (s *S) TestUnmarshalIntegerKeys(c *C) {
+	var small map[uint8]string
+	err := yaml.Unmarshal([]byte("{1: a, 255: b, 256: c, -1: d}"), &small)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: cannot unmarshal !!int `256` into uint8\n"+
+		"  line 1: cannot unmarshal !!int `-1` into uint8")
+	c.Assert(small, DeepEquals, map[uint8]string{1: "a", 255: "b"})
+
+	var signed map[int16]string
+	err = yaml.Unmarshal([]byte("{-32768: a, 0x7fff: b, 32768: c}"), &signed)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!int `32768` into int16")
+	c.Assert(signed, DeepEquals, map[int16]string{-32768: "a", 32767: "b"})
+
+	// Integers too large for int64 resolve as floats, which must still be
+	// range checked.
+	var large map[uint64]string
+	err = yaml.Unmarshal([]byte("{18446744073709551615: a, 18446744073709551616: b}"), &large)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!float `1844674...` into uint64")
+	c.Assert(large, DeepEquals, map[uint64]string{math.MaxUint64: "a"})
+
+	var ints map[int64]string
+	err = yaml.Unmarshal([]byte("{9223372036854775808: a, -9223372036854775808: b, -1e30: c, 1e19: d}"), &ints)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: cannot unmarshal !!int `9223372...` into int64\n"+
+		"  line 1: cannot unmarshal !!float `-1e30` into int64\n"+
+		"  line 1: cannot unmarshal !!float `1e19` into int64")
+	c.Assert(ints, DeepEquals, map[int64]string{math.MinInt64: "b"})
+}
+
 func (s *S) TestUnmarshalFullTimestamp(c *C) {
 	// Full timestamp in same format as encoded. This is confirmed to be
 	// properly decoded by Python as a timestamp as well.
@@ -844,6 +1316,40 @@ func (s *S) TestUnmarshalFullTimestamp(c *C) {
 	c.Assert(t.(time.Time).In(time.UTC), Equals, time.Date(2015, 2, 24, 21, 19, 39, 123456789, time.UTC))
 }
 
+func (s *S) TestTimestampOffsetRoundTrip(c *C) {
+	tests := []struct {
+		data   string
+		offset int
+		out    string
+	}{
+		{"at: 2020-01-01T00:00:00+05:30\n", 5*3600 + 30*60, "at: 2020-01-01T00:00:00+05:30\n"},
+		{"at: 2020-01-01t00:00:00-08:00\n", -8 * 3600, "at: 2020-01-01T00:00:00-08:00\n"},
+		{"at: 2001-12-14 21:59:43.10 -5\n", -5 * 3600, "at: 2001-12-14T21:59:43.1-05:00\n"},
+		{"at: 2001-12-14 21:59:43.10 +05:45\n", 5*3600 + 45*60, "at: 2001-12-14T21:59:43.1+05:45\n"},
+		{"at: 2001-12-14 21:59:43.10Z\n", 0, "at: 2001-12-14T21:59:43.1Z\n"},
+	}
+	for _, t := range tests {
+		var v struct{ At time.Time }
+		c.Assert(yaml.Unmarshal([]byte(t.data), &v), IsNil, Commentf("data: %q", t.data))
+		_, offset := v.At.Zone()
+		c.Assert(offset, Equals, t.offset, Commentf("data: %q", t.data))
+		out, err := yaml.Marshal(&v)
+		c.Assert(err, IsNil)
+		c.Assert(string(out), Equals, t.out)
+
+		var m map[string]interface{}
+		c.Assert(yaml.Unmarshal([]byte(t.data), &m), IsNil)
+		c.Assert(m["at"].(time.Time).Equal(v.At), Equals, true)
+		out, err = yaml.Marshal(m)
+		c.Assert(err, IsNil)
+		c.Assert(string(out), Equals, t.out)
+	}
+
+	var v interface{}
+	c.Assert(yaml.Unmarshal([]byte("2001-13-14 21:59:43 -5"), &v), IsNil)
+	c.Assert(v, Equals, "2001-13-14 21:59:43 -5")
+}
+
 func (s *S) TestDecoderSingleDocument(c *C) {
 	// Test that Decoder.Decode works as expected on
 	// all the unmarshal tests.
@@ -905,6 +1411,45 @@ func (s *S) TestDecoder(c *C) {
 	}
 }
 
+func (s *S) TestDecoderReset(c *C) {
+	decodeAll := func(dec *yaml.Decoder) []interface{} {
+		var values []interface{}
+		for {
+			var value interface{}
+			err := dec.Decode(&value)
+			if err == io.EOF {
+				return values
+			}
+			c.Assert(err, IsNil)
+			values = append(values, value)
+		}
+	}
+	reused := yaml.NewDecoder(strings.NewReader("a: [1, 2]\n---\nleft: unread\n"))
+	var value interface{}
+	c.Assert(reused.Decode(&value), IsNil)
+	for i, item := range decoderTests {
+		c.Logf("test %d: %q", i, item.data)
+		want := decodeAll(yaml.NewDecoder(strings.NewReader(item.data)))
+		reused.Reset(strings.NewReader(item.data))
+		c.Assert(decodeAll(reused), DeepEquals, want)
+	}
+
+	// Settings are kept.
+	dec := yaml.NewDecoder(strings.NewReader("a:\n\tb: 1\n"))
+	dec.SetAllowTabs(true)
+	dec.SetLimitBytes(12)
+	dec.KnownFields(true)
+	var v struct{ A struct{ B int } }
+	c.Assert(dec.Decode(&v), IsNil)
+	dec.Reset(strings.NewReader("a:\n\tb: 2\n"))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.A.B, Equals, 2)
+	dec.Reset(strings.NewReader("a:\n\tc: 3\n"))
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 2: field c not found in type .*")
+	dec.Reset(strings.NewReader("a:\n\tb: 1234567\n"))
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: input error: input is larger than the limit of 12 bytes")
+}
+
 type errReader struct{}
 
 func (errReader) Read([]byte) (int, error) {
@@ -923,6 +1468,66 @@ func (s *S) TestUnmarshalNaN(c *C) {
 	c.Assert(math.IsNaN(value["notanum"].(float64)), Equals, true)
 }
 
+func (s *S) TestUnmarshalMultiLevelPointers(c *C) {
+	var v struct {
+		A **int
+		B **int
+		C *[]*string
+	}
+	one := 1
+	pone := &one
+	v.A = &pone
+	err := yaml.Unmarshal([]byte("a: null\nb: 2\nc: [x, null, z]"), &v)
+	c.Assert(err, IsNil)
+
+	// A null replaces the whole chain with a nil pointer, and leaves
+	// the previously referenced values alone.
+	c.Assert(v.A, IsNil)
+	c.Assert(*pone, Equals, 1)
+
+	c.Assert(v.B, NotNil)
+	c.Assert(*v.B, NotNil)
+	c.Assert(**v.B, Equals, 2)
+
+	c.Assert(v.C, NotNil)
+	c.Assert(*v.C, HasLen, 3)
+	c.Assert(*(*v.C)[0], Equals, "x")
+	c.Assert((*v.C)[1], IsNil)
+	c.Assert(*(*v.C)[2], Equals, "z")
+
+	var ppp ***string
+	err = yaml.Unmarshal([]byte("deep"), &ppp)
+	c.Assert(err, IsNil)
+	c.Assert(***ppp, Equals, "deep")
+
+	// Decoding null through a **string clears the inner pointer, while
+	// the outer one still refers to it.
+	old := "old"
+	inner := &old
+	outer := &inner
+	err = yaml.Unmarshal([]byte("null"), outer)
+	c.Assert(err, IsNil)
+	c.Assert(inner, IsNil)
+	c.Assert(old, Equals, "old")
+
+	// So does decoding it into a pointer field reached through pointers.
+	var w struct{ A *int }
+	w.A = pone
+	pw := &w
+	err = yaml.Unmarshal([]byte("a: null"), &pw)
+	c.Assert(err, IsNil)
+	c.Assert(pw, Equals, &w)
+	c.Assert(w.A, IsNil)
+	c.Assert(*pone, Equals, 1)
+
+	// A value allocates the inner pointer again.
+	err = yaml.Unmarshal([]byte("new"), outer)
+	c.Assert(err, IsNil)
+	c.Assert(inner, NotNil)
+	c.Assert(*inner, Equals, "new")
+	c.Assert(old, Equals, "old")
+}
+
 func (s *S) TestUnmarshalDurationInt(c *C) {
 	// Don't accept plain ints as durations as it's unclear (issue #200).
 	var d time.Duration
@@ -1703,6 +2308,775 @@ func (s *S) TestUnmarshalKnownFields(c *C) {
 	}
 }
 
+func (s *S) TestDecoderKeyNormalizer(c *C) {
+	type T struct {
+		Name string
+		Port int
+	}
+	for _, data := range []string{"Name: a\nPORT: 1", "NAME: a\nport: 1"} {
+		var v T
+		dec := yaml.NewDecoder(strings.NewReader(data))
+		dec.SetKeyNormalizer(strings.ToLower)
+		err := dec.Decode(&v)
+		c.Assert(err, IsNil)
+		c.Assert(v, Equals, T{Name: "a", Port: 1})
+	}
+
+	var m map[string]interface{}
+	dec := yaml.NewDecoder(strings.NewReader("A: 1\nb: {C: 2}"))
+	dec.SetKeyNormalizer(strings.ToLower)
+	err := dec.Decode(&m)
+	c.Assert(err, IsNil)
+	c.Assert(m, DeepEquals, map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": 2}})
+
+	var v T
+	dec = yaml.NewDecoder(strings.NewReader("Name: a\nNAME: b"))
+	dec.SetKeyNormalizer(strings.ToLower)
+	err = dec.Decode(&v)
+	c.Assert(err, ErrorMatches, `yaml: unmarshal errors:\n  line 2: mapping key "NAME" collides with key "Name" at line 1 once normalized`)
+}
+
+func (s *S) TestDecoderDefaulter(c *C) {
+	type Server struct {
+		Host string
+		Port int `default:"8080"`
+	}
+	defaulter := func(f reflect.StructField) (interface{}, bool) {
+		if v, ok := f.Tag.Lookup("default"); ok {
+			n, err := strconv.Atoi(v)
+			return n, err == nil
+		}
+		return nil, false
+	}
+	tests := []struct {
+		data string
+		want Server
+	}{
+		{"server: {host: a}", Server{Host: "a", Port: 8080}},
+		{"server: {host: a, port: 9000}", Server{Host: "a", Port: 9000}},
+		{"server: {host: a, port: 0}", Server{Host: "a", Port: 0}},
+		{"base: &b {port: 9000}\nserver: {<<: *b, host: a}", Server{Host: "a", Port: 9000}},
+	}
+	for _, t := range tests {
+		var v struct{ Server Server }
+		dec := yaml.NewDecoder(strings.NewReader(t.data))
+		dec.SetDefaulter(defaulter)
+		c.Assert(dec.Decode(&v), IsNil)
+		c.Assert(v.Server, Equals, t.want, Commentf("data: %q", t.data))
+	}
+
+	var v Server
+	dec := yaml.NewDecoder(strings.NewReader("port: 1"))
+	dec.SetDefaulter(func(f reflect.StructField) (interface{}, bool) { return 42, true })
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, `yaml: unmarshal errors:\n  line 1: cannot use default 42 of type int for field Host of type string`)
+}
+
+func (s *S) TestDecoderEmptyDocAs(c *C) {
+	type T struct{ A int }
+	tests := []struct {
+		mode  yaml.EmptyDocMode
+		value T
+		iface interface{}
+		err   error
+	}{
+		{yaml.EmptyDocNil, T{A: 1}, nil, nil},
+		{yaml.EmptyDocZero, T{}, nil, nil},
+		{yaml.EmptyDocError, T{A: 1}, 1, yaml.ErrEmptyDocument},
+	}
+	for _, t := range tests {
+		dec := yaml.NewDecoder(strings.NewReader("---\n--- # no content\n---\n~\n"))
+		dec.SetEmptyDocAs(t.mode)
+		v := T{A: 1}
+		c.Assert(dec.Decode(&v), Equals, t.err)
+		c.Assert(v, Equals, t.value)
+		var iface interface{} = 1
+		c.Assert(dec.Decode(&iface), Equals, t.err)
+		c.Assert(iface, Equals, t.iface)
+
+		// Null values aren't empty documents.
+		p := &T{}
+		c.Assert(dec.Decode(&p), IsNil)
+		c.Assert(p, IsNil)
+		c.Assert(dec.Decode(&v), Equals, io.EOF)
+	}
+}
+
+func (s *S) TestDecoderRecordRawText(c *C) {
+	data := "a: \"a\\tb\"\n" +
+		"b:  &x 'it''s'  # comment\n" +
+		"\u00e9: !!str  plain\n" +
+		"c: |\n  line\n\n" +
+		"d: [1, 0x1F, ~]\n" +
+		"e:\n" +
+		"---\n" +
+		"\"\\u00e9\"\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetRecordRawText(true)
+	var n yaml.Node
+	c.Assert(dec.Decode(&n), IsNil)
+	var raw, values []string
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if n.Kind == yaml.ScalarNode {
+			raw = append(raw, n.RawValue)
+			values = append(values, n.Value)
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(&n)
+	c.Assert(raw, DeepEquals, []string{"a", `"a\tb"`, "b", "'it''s'", "\u00e9", "plain", "c", "|\n  line", "d", "1", "0x1F", "~", "e", ""})
+	c.Assert(values, DeepEquals, []string{"a", "a\tb", "b", "it's", "\u00e9", "plain", "c", "line\n", "d", "1", "0x1F", "~", "e", ""})
+
+	c.Assert(dec.Decode(&n), IsNil)
+	c.Assert(n.Content[0].RawValue, Equals, `"\u00e9"`)
+	c.Assert(n.Content[0].Value, Equals, "\u00e9")
+
+	// The text isn't recorded by default.
+	c.Assert(yaml.Unmarshal([]byte(data), &n), IsNil)
+	c.Assert(n.Content[0].Content[1].RawValue, Equals, "")
+}
+
+type genericSet[T comparable] map[T]struct{}
+
+type genericList[T any] []T
+
+func (s *S) TestUnmarshalGenericContainers(c *C) {
+	for _, data := range []string{"!!set {a, b}", "{a: , b: }", "[a, b, a]"} {
+		var set genericSet[string]
+		c.Assert(yaml.Unmarshal([]byte(data), &set), IsNil)
+		c.Assert(set, DeepEquals, genericSet[string]{"a": {}, "b": {}}, Commentf("data: %q", data))
+	}
+
+	var nums genericSet[int]
+	c.Assert(yaml.Unmarshal([]byte("[1, 2]"), &nums), IsNil)
+	c.Assert(nums, DeepEquals, genericSet[int]{1: {}, 2: {}})
+
+	var list genericList[int]
+	c.Assert(yaml.Unmarshal([]byte("[1, 2, 3]"), &list), IsNil)
+	c.Assert(list, DeepEquals, genericList[int]{1, 2, 3})
+
+	var v struct {
+		Sets []genericSet[string]
+		Map  map[string]genericList[genericList[int]]
+	}
+	c.Assert(yaml.Unmarshal([]byte("sets: [[x], !!set {y}]\nmap: {a: [[1], [2, 3]]}"), &v), IsNil)
+	c.Assert(v.Sets, DeepEquals, []genericSet[string]{{"x": {}}, {"y": {}}})
+	c.Assert(v.Map, DeepEquals, map[string]genericList[genericList[int]]{"a": {{1}, {2, 3}}})
+
+	var bad genericSet[interface{}]
+	err := yaml.Unmarshal([]byte("[[1]]"), &bad)
+	c.Assert(err, ErrorMatches, `yaml: invalid map key: \[\]interface \{\}\{1\}`)
+}
+
+type pluginConfig interface{}
+
+type httpConfig struct {
+	URL     string
+	Timeout int
+}
+
+type grpcConfig struct {
+	Address string
+	TLS     bool
+}
+
+func (s *S) TestDecoderAddDecodeHook(c *C) {
+	type T struct {
+		Addr  net.IP
+		Peers []net.IP
+		Name  string
+		Port  int
+	}
+	ipType := reflect.TypeOf(net.IP{})
+	toIP := func(from, to reflect.Type, data interface{}) (interface{}, bool, error) {
+		if from.Kind() != reflect.String || to != ipType {
+			return nil, false, nil
+		}
+		if data == "localhost" {
+			return net.IPv4(127, 0, 0, 1), true, nil
+		}
+		ip := net.ParseIP(data.(string))
+		if ip == nil {
+			return nil, false, fmt.Errorf("invalid IP address %q", data)
+		}
+		return ip, true, nil
+	}
+	var calls int
+	count := func(from, to reflect.Type, data interface{}) (interface{}, bool, error) {
+		calls++
+		return nil, false, nil
+	}
+
+	dec := yaml.NewDecoder(strings.NewReader("addr: localhost\npeers: [10.0.0.1, \"::1\"]\nname: web\nport: 80\n"))
+	dec.AddDecodeHook(toIP)
+	dec.AddDecodeHook(count)
+	var v T
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, T{
+		Addr:  net.IPv4(127, 0, 0, 1),
+		Peers: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("::1")},
+		Name:  "web",
+		Port:  80,
+	})
+	// Keys are scalars too.
+	c.Assert(calls, Equals, 6)
+
+	dec = yaml.NewDecoder(strings.NewReader("addr: nowhere\nport: 80\n"))
+	dec.AddDecodeHook(toIP)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 1: invalid IP address \"nowhere\"")
+
+	dec = yaml.NewDecoder(strings.NewReader("port: 80\n"))
+	dec.AddDecodeHook(func(from, to reflect.Type, data interface{}) (interface{}, bool, error) {
+		return "eighty", to.Kind() == reflect.Int, nil
+	})
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: unmarshal errors:\n  line 1: decode hook returned string for int")
+}
+
+func (s *S) TestDecoderDiscriminator(c *C) {
+	data := "plugins:\n" +
+		"- type: http\n  url: http://example.com\n  timeout: 5\n" +
+		"- type: grpc\n  address: localhost:9000\n  tls: true\n" +
+		"- type: other\n  name: x\n"
+	var v struct {
+		Plugins []pluginConfig
+	}
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.KnownFields(true)
+	dec.SetDiscriminator("type", func(disc string) interface{} {
+		switch disc {
+		case "http":
+			return &httpConfig{}
+		case "grpc":
+			return grpcConfig{}
+		}
+		return nil
+	})
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.Plugins, DeepEquals, []pluginConfig{
+		&httpConfig{URL: "http://example.com", Timeout: 5},
+		grpcConfig{Address: "localhost:9000", TLS: true},
+		map[string]interface{}{"type": "other", "name": "x"},
+	})
+
+	var plugin fmt.Stringer
+	dec = yaml.NewDecoder(strings.NewReader("type: http\nurl: x\n"))
+	dec.SetDiscriminator("type", func(string) interface{} { return httpConfig{} })
+	err := dec.Decode(&plugin)
+	c.Assert(err, ErrorMatches, `yaml: unmarshal errors:\n  line 1: cannot unmarshal type http into fmt.Stringer`)
+}
+
+func (s *S) TestDecoderRegisterType(c *C) {
+	type port int
+	data := "" +
+		"main: !http\n  url: http://example.com\n  timeout: 5\n" +
+		"plugins:\n" +
+		"- !grpc {address: localhost:9000, tls: true}\n" +
+		"- !port 8080\n" +
+		"- !other {name: x}\n" +
+		"- {name: y}\n" +
+		"fixed: !port 9090\n"
+	var v struct {
+		Main    pluginConfig
+		Plugins []pluginConfig
+		Fixed   string
+	}
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.KnownFields(true)
+	dec.RegisterType("!http", reflect.TypeOf(&httpConfig{}))
+	dec.RegisterType("!grpc", reflect.TypeOf(grpcConfig{}))
+	dec.RegisterType("!port", reflect.TypeOf(port(0)))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v.Main, DeepEquals, &httpConfig{URL: "http://example.com", Timeout: 5})
+	c.Assert(v.Plugins, DeepEquals, []pluginConfig{
+		grpcConfig{Address: "localhost:9000", TLS: true},
+		port(8080),
+		map[string]interface{}{"name": "x"},
+		map[string]interface{}{"name": "y"},
+	})
+	c.Assert(v.Fixed, Equals, "9090")
+
+	var plugin fmt.Stringer
+	dec = yaml.NewDecoder(strings.NewReader("!http {url: x}\n"))
+	dec.RegisterType("!http", reflect.TypeOf(httpConfig{}))
+	err := dec.Decode(&plugin)
+	c.Assert(err, ErrorMatches, `yaml: unmarshal errors:\n  line 1: cannot unmarshal !http into fmt.Stringer as yaml_test.httpConfig`)
+
+	dec = yaml.NewDecoder(strings.NewReader("!http {url: x, extra: 1}\n"))
+	dec.KnownFields(true)
+	dec.RegisterType("!http", reflect.TypeOf(httpConfig{}))
+	var any interface{}
+	err = dec.Decode(&any)
+	c.Assert(err, ErrorMatches, `yaml: unmarshal errors:\n  line 1: field extra not found in type yaml_test.httpConfig`)
+}
+
+func (s *S) TestDecoderIncludeResolver(c *C) {
+	files := map[string]string{
+		"main.yaml":  "name: app\ndatabase: !include db.yaml\n",
+		"db.yaml":    "host: localhost\nport: 5432\ncredentials: !include creds.yaml\n",
+		"creds.yaml": "user: admin\n",
+		"a.yaml":     "b: !include b.yaml\n",
+		"b.yaml":     "a: !include a.yaml\n",
+	}
+	resolver := func(path string) (*yaml.Node, error) {
+		data, ok := files[path]
+		if !ok {
+			return nil, errors.New("file not found")
+		}
+		var n yaml.Node
+		err := yaml.Unmarshal([]byte(data), &n)
+		return &n, err
+	}
+
+	var v map[string]interface{}
+	dec := yaml.NewDecoder(strings.NewReader(files["main.yaml"]))
+	dec.SetIncludeResolver(resolver)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{
+		"name": "app",
+		"database": map[string]interface{}{
+			"host":        "localhost",
+			"port":        5432,
+			"credentials": map[string]interface{}{"user": "admin"},
+		},
+	})
+
+	dec = yaml.NewDecoder(strings.NewReader("a: !include a.yaml\n"))
+	dec.SetIncludeResolver(resolver)
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, `yaml: line 1: include cycle: a.yaml -> b.yaml -> a.yaml`)
+
+	dec = yaml.NewDecoder(strings.NewReader("a: !include missing.yaml\n"))
+	dec.SetIncludeResolver(resolver)
+	err = dec.Decode(&v)
+	c.Assert(err, ErrorMatches, `yaml: line 1: cannot include missing.yaml: file not found`)
+
+	// Every site gets its own copy of the nodes returned.
+	var shared yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(files["db.yaml"]), &shared), IsNil)
+	dec = yaml.NewDecoder(strings.NewReader("a: !include db.yaml\nb: !include db.yaml\n"))
+	dec.SetIncludeResolver(func(path string) (*yaml.Node, error) {
+		if path == "db.yaml" {
+			return &shared, nil
+		}
+		return resolver(path)
+	})
+	var n yaml.Node
+	c.Assert(dec.Decode(&n), IsNil)
+	a, b := n.Content[0].Content[1], n.Content[0].Content[3]
+	a.Content[1].Value = "remote"
+	c.Assert(b.Content[1].Value, Equals, "localhost")
+	c.Assert(shared.Content[0].Content[1].Value, Equals, "localhost")
+	c.Assert(shared.Content[0].Content[5].Tag, Equals, "!include")
+}
+
+func (s *S) TestUnmarshalByteSizeErrors(c *C) {
+	var v struct {
+		A int8 ",bytes"
+		B uint ",bytes"
+		C int  ",bytes"
+		D int  ",bytes"
+	}
+	err := yaml.Unmarshal([]byte("a: 1Ki\nb: -1\nc: 1.5\nd: 10Xi"), &v)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n"+
+		"  line 1: cannot unmarshal !!str `1Ki` into int8\n"+
+		"  line 2: cannot unmarshal !!int `-1` into uint\n"+
+		"  line 3: cannot unmarshal !!float `1.5` into int\n"+
+		"  line 4: cannot unmarshal !!str `10Xi` into int")
+
+	var bad struct {
+		A string ",bytes"
+	}
+	c.Assert(func() { yaml.Unmarshal([]byte("a: 1Ki"), &bad) }, PanicMatches, "option ,bytes needs an integer field in struct .*")
+}
+
+func (s *S) TestDecoderAllowTabs(c *C) {
+	data := "a:\n\tb: 1\n\tc:\n\t\t- d\te\n"
+	var v interface{}
+	err := yaml.Unmarshal([]byte(data), &v)
+	c.Assert(err, ErrorMatches, "yaml: line 2: found a tab character used for indentation")
+
+	err = yaml.Unmarshal([]byte("a:\n  b: 1\n\tc: 2\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: line 3: found a tab character used for indentation")
+
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetAllowTabs(true)
+	err = dec.Decode(&v)
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{
+		"a": map[string]interface{}{"b": 1, "c": []interface{}{"d\te"}},
+	})
+
+	// Tabs deeper than the indentation of block scalars are kept, as
+	// with NormalizeIndentation.
+	data = "a: |\n\tx\n\t\ty\n"
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetAllowTabs(true)
+	dec.SetTabWidth(4)
+	err = dec.Decode(&v)
+	c.Assert(err, IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{"a": "x\n\ty\n"})
+	out, err := yaml.NormalizeIndentation([]byte(data), 4)
+	c.Assert(err, IsNil)
+	var normalized interface{}
+	c.Assert(yaml.Unmarshal(out, &normalized), IsNil)
+	c.Assert(normalized, DeepEquals, v)
+}
+
+func (s *S) TestDecoderMaxDocuments(c *C) {
+	data := "a: 1\n---\na: 2\n---\na: 3\n"
+	var v map[string]int
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMaxDocuments(2)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v["a"], Equals, 1)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v["a"], Equals, 2)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: line 4: stream holds more than the limit of 2 documents")
+
+	// Streams within the limit end as usual.
+	dec.Reset(strings.NewReader(data))
+	dec.SetMaxDocuments(3)
+	for i := 1; i <= 3; i++ {
+		c.Assert(dec.Decode(&v), IsNil)
+		c.Assert(v["a"], Equals, i)
+	}
+	c.Assert(dec.Decode(&v), Equals, io.EOF)
+
+	// Documents read element by element count as well.
+	dec = yaml.NewDecoder(strings.NewReader("- 1\n- 2\n---\n- 3\n"))
+	dec.SetMaxDocuments(1)
+	ch := make(chan int, 4)
+	c.Assert(dec.DecodeToChannel(ch), IsNil)
+	c.Assert(dec.DecodeArrayElement(new(int)), ErrorMatches, "yaml: line 3: stream holds more than the limit of 1 document")
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetMaxDocuments(0)
+	for i := 1; i <= 3; i++ {
+		c.Assert(dec.Decode(&v), IsNil)
+	}
+}
+
+func (s *S) TestDecoderLimitBytes(c *C) {
+	data := "a: 1\nb: [2, 3]\n"
+	var v map[string]interface{}
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetLimitBytes(int64(len(data)))
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{"a": 1, "b": []interface{}{2, 3}})
+	c.Assert(dec.Decode(&v), Equals, io.EOF)
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetLimitBytes(int64(len(data)) - 1)
+	err := dec.Decode(&v)
+	c.Assert(err, ErrorMatches, fmt.Sprintf("yaml: input error: input is larger than the limit of %d bytes", len(data)-1))
+
+	big := "items:\n" + strings.Repeat("  - item\n", 10000)
+	dec = yaml.NewDecoder(strings.NewReader(big))
+	dec.SetLimitBytes(4096)
+	c.Assert(dec.Decode(&v), ErrorMatches, "yaml: input error: input is larger than the limit of 4096 bytes")
+
+	// The limit applies to the input, before tabs are expanded.
+	dec = yaml.NewDecoder(strings.NewReader("a:\n\tb: 1\n"))
+	dec.SetAllowTabs(true)
+	dec.SetTabWidth(8)
+	dec.SetLimitBytes(10)
+	v = nil
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{"a": map[string]interface{}{"b": 1}})
+
+	dec = yaml.NewDecoder(strings.NewReader(data))
+	dec.SetLimitBytes(1)
+	dec.SetLimitBytes(0)
+	c.Assert(dec.Decode(&v), IsNil)
+}
+
+func (s *S) TestNormalizeIndentation(c *C) {
+	data := "a:\n\tb: 1\t# one\n\tc:\n\t\t- d\te\n\tf: |\n\t\tx\n\n\t\t\ty\n\tg: >2\n\t  z\n"
+	var v interface{}
+	c.Assert(yaml.Unmarshal([]byte(data), &v), ErrorMatches, "yaml: line 2: found a tab character used for indentation")
+
+	out, err := yaml.NormalizeIndentation([]byte(data), 2)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "a:\n  b: 1\t# one\n  c:\n    - d\te\n  f: |\n    x\n\n    \ty\n  g: >2\n    z\n")
+	c.Assert(yaml.Unmarshal(out, &v), IsNil)
+	c.Assert(v, DeepEquals, map[string]interface{}{
+		"a": map[string]interface{}{
+			"b": 1,
+			"c": []interface{}{"d\te"},
+			"f": "x\n\n\ty\n",
+			"g": "z\n",
+		},
+	})
+
+	out, err = yaml.NormalizeIndentation([]byte("a:\n\tb: 1\n"), 4)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "a:\n    b: 1\n")
+
+	_, err = yaml.NormalizeIndentation([]byte("a:\n\tb: 1\n\t- c\n"), 2)
+	c.Assert(err, ErrorMatches, "yaml: line 1: did not find expected key")
+	_, err = yaml.NormalizeIndentation([]byte("a: 1\n"), 0)
+	c.Assert(err, ErrorMatches, "yaml: tab width must be at least one space")
+}
+
+func (s *S) TestDetectIndent(c *C) {
+	tests := []struct {
+		data  string
+		width int
+		ok    bool
+	}{
+		{"a:\n  b: 1\n  c:\n      d: 2\n", 2, true},
+		{"# Settings:\na:\n\n    b: 1\n", 4, true},
+		{"a: |\n      text:\n        more\nb:\n  c: 1\n", 2, true},
+		{"items:\n- name: x\n  sub:\n    y: 1\n", 2, true},
+		{"- name: x\n  sub:\n      y: 1\n", 4, true},
+		{"a: 1 # note:\nb: [1, 2]\nc:\n- d\n", 0, false},
+		{"", 0, false},
+	}
+	for _, t := range tests {
+		width, ok := yaml.DetectIndent([]byte(t.data))
+		c.Assert(ok, Equals, t.ok, Commentf("data: %q", t.data))
+		c.Assert(width, Equals, t.width, Commentf("data: %q", t.data))
+	}
+}
+
+type validatedServer struct {
+	Host string
+	Port int
+}
+
+func (s *validatedServer) ValidateYAML(path string) error {
+	if s.Port < 1 || s.Port > 65535 {
+		return fmt.Errorf("port %d out of range", s.Port)
+	}
+	return nil
+}
+
+type validatedConfig struct {
+	Name    string
+	Servers []validatedServer
+	Backup  *validatedServer
+	paths   []string
+}
+
+func (c *validatedConfig) ValidateYAML(path string) error {
+	c.paths = append(c.paths, path)
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func (s *S) TestUnmarshalValidator(c *C) {
+	data := "name: app\nservers:\n  - host: a\n    port: 80\n  - host: b\n    port: 70000\n"
+	var v validatedConfig
+	err := yaml.Unmarshal([]byte(data), &v)
+	c.Assert(err, ErrorMatches, `yaml: line 5: servers\[1\]: port 70000 out of range`)
+	verr, ok := err.(*yaml.ValidationError)
+	c.Assert(ok, Equals, true)
+	c.Assert(verr.Path, Equals, "servers[1]")
+	c.Assert(verr.Line, Equals, 5)
+	c.Assert(verr.Column, Equals, 5)
+	c.Assert(errors.Unwrap(err), ErrorMatches, "port 70000 out of range")
+
+	v = validatedConfig{}
+	err = yaml.Unmarshal([]byte("servers: []\nbackup:\n  port: 0\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: line 3: backup: port 0 out of range")
+
+	v = validatedConfig{}
+	err = yaml.Unmarshal([]byte("servers: [{port: 1}]\n"), &v)
+	c.Assert(err, ErrorMatches, "yaml: line 1: name is required")
+
+	v = validatedConfig{}
+	c.Assert(yaml.Unmarshal([]byte(data[:len(data)-6]+"443\n"), &v), IsNil)
+	c.Assert(v.paths, DeepEquals, []string{""})
+
+	// Validators run on merged values, and on values within collections.
+	var list struct {
+		Base  validatedConfig
+		Items []validatedConfig
+	}
+	err = yaml.Unmarshal([]byte("base: &b {name: x}\nitems:\n  - {<<: *b}\n  - {<<: *b, name: ''}\n"), &list)
+	c.Assert(err, ErrorMatches, `yaml: line 4: items\[1\]: name is required`)
+}
+
+func (s *S) TestUnmarshalRemainInMapValues(c *C) {
+	type Entry struct {
+		Name  string
+		Extra map[string]interface{} `yaml:",remain"`
+	}
+	data := "a:\n  name: first\n  color: red\n  size: 3\nb:\n  name: second\nc:\n  tags: [x, y]\n"
+	var v map[string]Entry
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.KnownFields(true)
+	c.Assert(dec.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, map[string]Entry{
+		"a": {Name: "first", Extra: map[string]interface{}{"color": "red", "size": 3}},
+		"b": {Name: "second"},
+		"c": {Extra: map[string]interface{}{"tags": []interface{}{"x", "y"}}},
+	})
+
+	out, err := yaml.Marshal(v)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "a:\n    name: first\n    color: red\n    size: 3\nb:\n    name: second\nc:\n    name: \"\"\n    tags:\n        - x\n        - \"y\"\n")
+
+	var bad struct {
+		Extra []string `yaml:",remain"`
+	}
+	c.Assert(func() { yaml.Unmarshal([]byte("a: 1"), &bad) }, PanicMatches, "option ,inline may only be used on a struct or map field")
+	var badKeys struct {
+		Extra map[int]string `yaml:",remain"`
+	}
+	c.Assert(func() { yaml.Unmarshal([]byte("a: 1"), &badKeys) }, PanicMatches, "option ,inline needs a map with string keys in struct .*")
+}
+
+func (s *S) TestUnmarshalNodeField(c *C) {
+	type server struct {
+		Node *yaml.Node `yaml:"-,node"`
+		Host string
+		Port int
+	}
+	var v struct {
+		Node    yaml.Node `yaml:"-,node"`
+		Servers []server
+	}
+	data := "servers:\n  - host: a\n    port: 1\n  - host: b\n    port: 2\n"
+	err := yaml.Unmarshal([]byte(data), &v)
+	c.Assert(err, IsNil)
+	c.Assert(v.Node.Kind, Equals, yaml.MappingNode)
+	c.Assert(v.Node.Line, Equals, 1)
+	c.Assert(v.Servers, HasLen, 2)
+	for i, srv := range v.Servers {
+		c.Assert(srv.Host, Equals, string(rune('a'+i)))
+		c.Assert(srv.Port, Equals, i+1)
+		c.Assert(srv.Node, Equals, v.Node.Content[1].Content[i])
+		c.Assert(srv.Node.Line, Equals, 2*i+2)
+		c.Assert(srv.Node.Column, Equals, 5)
+	}
+
+	// The node isn't marshaled.
+	out, err := yaml.Marshal(v.Servers[0])
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "host: a\nport: 1\n")
+
+	var bad struct {
+		Node *yaml.Node `yaml:"node,node"`
+	}
+	c.Assert(func() { yaml.Unmarshal([]byte("a: 1"), &bad) }, PanicMatches, `option ,node needs a yaml.Node or \*yaml.Node field named "-" in struct .*`)
+}
+
+func (s *S) TestDecoderStats(c *C) {
+	data := "a: &x [1, 2]\nb: *x\nc: {d: *x}\n---\nplain\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	c.Assert(dec.Stats(), Equals, yaml.DecodeStats{})
+
+	var v interface{}
+	err := dec.Decode(&v)
+	c.Assert(err, IsNil)
+	c.Assert(dec.Stats(), Equals, yaml.DecodeStats{
+		Aliases:  2,
+		MaxDepth: 4,
+		Nodes:    15,
+	})
+
+	err = dec.Decode(&v)
+	c.Assert(err, IsNil)
+	c.Assert(dec.Stats(), Equals, yaml.DecodeStats{Nodes: 1, MaxDepth: 1})
+}
+
+func (s *S) TestDecodeArrayElement(c *C) {
+	type item struct {
+		ID   int
+		Name string
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# items\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&buf, "- id: %d\n  name: &n%d item%d\n", i, i, i)
+	}
+	buf.WriteString("---\n- *unknown\n")
+
+	dec := yaml.NewDecoder(&buf)
+	for i := 0; i < 100; i++ {
+		var v item
+		c.Assert(dec.DecodeArrayElement(&v), IsNil)
+		c.Assert(v, Equals, item{i, fmt.Sprintf("item%d", i)})
+	}
+	var v item
+	c.Assert(dec.DecodeArrayElement(&v), Equals, io.EOF)
+	c.Assert(dec.DecodeArrayElement(&v), ErrorMatches, `yaml: unknown anchor 'unknown' referenced`)
+
+	dec = yaml.NewDecoder(strings.NewReader("- &a 1\n- *a\n---\na: 1\n"))
+	var n int
+	c.Assert(dec.DecodeArrayElement(&n), IsNil)
+	c.Assert(dec.DecodeArrayElement(&n), IsNil)
+	c.Assert(n, Equals, 1)
+	c.Assert(dec.Decode(&n), ErrorMatches, "yaml: Decode called while decoding sequence elements")
+	c.Assert(dec.DecodeArrayElement(&n), Equals, io.EOF)
+	c.Assert(dec.DecodeArrayElement(&n), ErrorMatches, "yaml: line 4: document root is not a sequence")
+}
+
+func (s *S) TestDecodeToChannel(c *C) {
+	dec := yaml.NewDecoder(strings.NewReader("- 1\n- 2\n- &x 3\n- *x\n---\n- 5\n- five\n"))
+	ch := make(chan int)
+	errc := make(chan error, 1)
+	go func() { errc <- dec.DecodeToChannel(ch) }()
+	var got []int
+	for n := range ch {
+		got = append(got, n)
+	}
+	c.Assert(<-errc, IsNil)
+	c.Assert(got, DeepEquals, []int{1, 2, 3, 3})
+
+	// The channel is closed on errors as well.
+	ch = make(chan int, 2)
+	c.Assert(dec.DecodeToChannel(ch), ErrorMatches, "yaml: unmarshal errors:\n  line 7: cannot unmarshal !!str `five` into int")
+	got = nil
+	for n := range ch {
+		got = append(got, n)
+	}
+	c.Assert(got, DeepEquals, []int{5})
+
+	c.Assert(dec.DecodeToChannel([]int{}), ErrorMatches, `yaml: cannot decode sequence elements into \[\]int, which isn't a channel to send on`)
+	c.Assert(dec.DecodeToChannel(make(<-chan int)), ErrorMatches, `yaml: cannot decode sequence elements into <-chan int, .*`)
+}
+
+func (s *S) TestMapSliceComments(c *C) {
+	data := "" +
+		"# Head of b.\n" +
+		"b: 1 # Line of b.\n" +
+		"a:\n" +
+		"    # Head of c.\n" +
+		"    c: # Line of c.\n" +
+		"        - x\n" +
+		"        - z\n" +
+		"    d:\n" +
+		"        - e: f # Line of e.\n" +
+		"# Foot of a.\n"
+	var m yaml.MapSlice
+	err := yaml.Unmarshal([]byte(data), &m)
+	c.Assert(err, IsNil)
+	c.Assert(m, HasLen, 2)
+	c.Assert(m[0], DeepEquals, yaml.MapItem{
+		Key:         "b",
+		Value:       1,
+		HeadComment: "# Head of b.",
+		LineComment: "# Line of b.",
+	})
+	c.Assert(m[1].Key, Equals, "a")
+	c.Assert(m[1].FootComment, Equals, "# Foot of a.")
+	c.Assert(m[1].Value.(yaml.MapSlice)[0].HeadComment, Equals, "# Head of c.")
+
+	out, err := yaml.Marshal(m)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, data)
+
+	err = yaml.Unmarshal([]byte("[1]"), &m)
+	c.Assert(err, ErrorMatches, "yaml: unmarshal errors:\n  line 1: cannot unmarshal !!seq into yaml.MapSlice")
+}
+
 type textUnmarshaler struct {
 	S string
 }
@@ -25,6 +25,7 @@ package yaml
 import (
 	"bytes"
 	"fmt"
+	"unicode/utf8"
 )
 
 // Flush the buffer if needed.
@@ -447,7 +448,12 @@ func yaml_emitter_emit_document_start(emitter *yaml_emitter_t, event *yaml_event
 		}
 
 		if len(emitter.head_comment) > 0 {
-			if !yaml_emitter_process_head_comment(emitter) {
+			// A blank line always follows the head comment of documents.
+			blank_after := emitter.blank_after_head_comment
+			emitter.blank_after_head_comment = false
+			ok := yaml_emitter_process_head_comment(emitter)
+			emitter.blank_after_head_comment = blank_after
+			if !ok {
 				return false
 			}
 			if !put_break(emitter) {
@@ -502,8 +508,12 @@ func yaml_emitter_emit_document_end(emitter *yaml_emitter_t, event *yaml_event_t
 	if event.typ != yaml_DOCUMENT_END_EVENT {
 		return yaml_emitter_set_emitter_error(emitter, "expected DOCUMENT-END")
 	}
-	// [Go] Force document foot separation.
-	emitter.foot_indent = 0
+	// [Go] Force document foot separation, unless the content ends with
+	// a block scalar keeping its trailing line breaks, which already
+	// separate it and would otherwise be one more.
+	if !emitter.open_ended || emitter.column > 0 {
+		emitter.foot_indent = 0
+	}
 	if !yaml_emitter_process_foot_comment(emitter) {
 		return false
 	}
@@ -541,7 +551,7 @@ func yaml_emitter_emit_flow_sequence_item(emitter *yaml_emitter_t, event *yaml_e
 	}
 
 	if event.typ == yaml_SEQUENCE_END_EVENT {
-		if emitter.canonical && !first && !trail {
+		if (emitter.canonical || emitter.flow_trailing_comma && emitter.flow_wrap_each) && !first && !trail {
 			if !yaml_emitter_write_indicator(emitter, []byte{','}, false, false, false) {
 				return false
 			}
@@ -549,7 +559,7 @@ func yaml_emitter_emit_flow_sequence_item(emitter *yaml_emitter_t, event *yaml_e
 		emitter.flow_level--
 		emitter.indent = emitter.indents[len(emitter.indents)-1]
 		emitter.indents = emitter.indents[:len(emitter.indents)-1]
-		if emitter.column == 0 || emitter.canonical && !first {
+		if emitter.column == 0 || (emitter.canonical || emitter.flow_wrap_each) && !first {
 			if !yaml_emitter_write_indent(emitter) {
 				return false
 			}
@@ -584,7 +594,7 @@ func yaml_emitter_emit_flow_sequence_item(emitter *yaml_emitter_t, event *yaml_e
 		}
 	}
 
-	if emitter.canonical || emitter.column > emitter.best_width {
+	if yaml_emitter_flow_break(emitter) {
 		if !yaml_emitter_write_indent(emitter) {
 			return false
 		}
@@ -611,6 +621,14 @@ func yaml_emitter_emit_flow_sequence_item(emitter *yaml_emitter_t, event *yaml_e
 	return true
 }
 
+// Check if the next entry of a flow collection starts on a new line.
+func yaml_emitter_flow_break(emitter *yaml_emitter_t) bool {
+	if emitter.canonical || emitter.flow_wrap_each {
+		return true
+	}
+	return emitter.column > emitter.best_width
+}
+
 // Expect a flow key node.
 func yaml_emitter_emit_flow_mapping_key(emitter *yaml_emitter_t, event *yaml_event_t, first, trail bool) bool {
 	if first {
@@ -624,7 +642,8 @@ func yaml_emitter_emit_flow_mapping_key(emitter *yaml_emitter_t, event *yaml_eve
 	}
 
 	if event.typ == yaml_MAPPING_END_EVENT {
-		if (emitter.canonical || len(emitter.head_comment)+len(emitter.foot_comment)+len(emitter.tail_comment) > 0) && !first && !trail {
+		if (emitter.canonical || emitter.flow_trailing_comma && emitter.flow_wrap_each ||
+			len(emitter.head_comment)+len(emitter.foot_comment)+len(emitter.tail_comment) > 0) && !first && !trail {
 			if !yaml_emitter_write_indicator(emitter, []byte{','}, false, false, false) {
 				return false
 			}
@@ -635,7 +654,7 @@ func yaml_emitter_emit_flow_mapping_key(emitter *yaml_emitter_t, event *yaml_eve
 		emitter.flow_level--
 		emitter.indent = emitter.indents[len(emitter.indents)-1]
 		emitter.indents = emitter.indents[:len(emitter.indents)-1]
-		if emitter.canonical && !first {
+		if (emitter.canonical || emitter.flow_wrap_each) && !first {
 			if !yaml_emitter_write_indent(emitter) {
 				return false
 			}
@@ -670,7 +689,7 @@ func yaml_emitter_emit_flow_mapping_key(emitter *yaml_emitter_t, event *yaml_eve
 		}
 	}
 
-	if emitter.canonical || emitter.column > emitter.best_width {
+	if yaml_emitter_flow_break(emitter) {
 		if !yaml_emitter_write_indent(emitter) {
 			return false
 		}
@@ -741,12 +760,34 @@ func yaml_emitter_emit_block_sequence_item(emitter *yaml_emitter_t, event *yaml_
 		emitter.states = emitter.states[:len(emitter.states)-1]
 		return true
 	}
+	blanks := emitter.preserve_blank_lines
+	if !first && emitter.sequence_item_spacing > 0 {
+		if !blanks || emitter.blank_lines_before < emitter.sequence_item_spacing {
+			emitter.blank_lines_before = emitter.sequence_item_spacing
+		}
+		blanks = true
+	}
+	// Blank lines go above the head comment, if there's one, as the
+	// comment belongs to the item that follows them.
+	if blanks && emitter.blank_lines_before > 0 && len(emitter.head_comment) > 0 {
+		if emitter.column > 0 {
+			if !put_break(emitter) {
+				return false
+			}
+		}
+		if !yaml_emitter_write_blank_lines(emitter, emitter.blank_lines_before) {
+			return false
+		}
+		emitter.blank_lines_before = 0
+		emitter.whitespace = true
+		emitter.foot_indent = -1
+	}
 	if !yaml_emitter_process_head_comment(emitter) {
 		return false
 	}
 
 	// Handle blank lines and indentation
-	if emitter.preserve_blank_lines && emitter.blank_lines_before > 0 {
+	if blanks && emitter.blank_lines_before > 0 {
 		// First, ensure we're at the start of a line
 		if emitter.column > 0 {
 			if !put_break(emitter) {
@@ -821,8 +862,9 @@ func yaml_emitter_emit_block_mapping_key(emitter *yaml_emitter_t, event *yaml_ev
 			// For top-level keys, yaml_emitter_write_indent will emit one line break, so we emit one fewer
 			// For nested keys, we may need different handling
 			targetBreaks := emitter.blank_lines_before
-			if emitter.indent == 0 {
-				// Top-level mapping - adjust by 1
+			if emitter.indent == 0 && !emitter.whitespace {
+				// Top-level mapping - adjust by 1, unless a line comment
+				// ending the previous line left no break to write.
 				targetBreaks = targetBreaks - 1
 			}
 
@@ -841,8 +883,9 @@ func yaml_emitter_emit_block_mapping_key(emitter *yaml_emitter_t, event *yaml_ev
 			// For top-level keys, yaml_emitter_write_indent will emit one line break, so we emit one fewer
 			// For nested keys, we may need different handling
 			targetBreaks := emitter.blank_lines_before
-			if emitter.indent == 0 {
-				// Top-level mapping - adjust by 1
+			if emitter.indent == 0 && !emitter.whitespace {
+				// Top-level mapping - adjust by 1, unless a line comment
+				// ending the previous line left no break to write.
 				targetBreaks = targetBreaks - 1
 			}
 
@@ -1000,9 +1043,29 @@ func yaml_emitter_emit_scalar(emitter *yaml_emitter_t, event *yaml_event_t) bool
 	if !yaml_emitter_increase_indent(emitter, true, false) {
 		return false
 	}
+	emitter.block_indent = 0
+	if style := emitter.scalar_data.style; style == yaml_LITERAL_SCALAR_STYLE || style == yaml_FOLDED_SCALAR_STYLE {
+		block_indent := event.block_indent
+		if block_indent == 0 {
+			block_indent = emitter.block_scalar_indent
+		}
+		if block_indent < 0 || block_indent > 9 {
+			return yaml_emitter_set_emitter_error(emitter, "block scalar indentation indicator must be between 1 and 9")
+		}
+		if block_indent > 0 {
+			// The content is indented relative to the parent node.
+			parent := emitter.indents[len(emitter.indents)-1]
+			if parent < 0 {
+				parent = 0
+			}
+			emitter.indent = parent + block_indent
+			emitter.block_indent = block_indent
+		}
+	}
 	if !yaml_emitter_process_scalar(emitter) {
 		return false
 	}
+	emitter.block_indent = 0
 	emitter.indent = emitter.indents[len(emitter.indents)-1]
 	emitter.indents = emitter.indents[:len(emitter.indents)-1]
 	emitter.state = emitter.states[len(emitter.states)-1]
@@ -1136,7 +1199,13 @@ func yaml_emitter_select_scalar_style(emitter *yaml_emitter_t, event *yaml_event
 			style = yaml_SINGLE_QUOTED_SCALAR_STYLE
 		}
 		if len(emitter.scalar_data.value) == 0 && (emitter.flow_level > 0 || emitter.simple_key_context) {
-			style = yaml_SINGLE_QUOTED_SCALAR_STYLE
+			if no_tag && event.implicit {
+				// Quoting would turn the implied null into an empty string.
+				emitter.scalar_data.value = []byte("null")
+				style = yaml_PLAIN_SCALAR_STYLE
+			} else {
+				style = yaml_SINGLE_QUOTED_SCALAR_STYLE
+			}
 		}
 		if no_tag && !event.implicit {
 			style = yaml_SINGLE_QUOTED_SCALAR_STYLE
@@ -1228,10 +1297,7 @@ func yaml_emitter_process_scalar(emitter *yaml_emitter_t) bool {
 // Write a head comment.
 func yaml_emitter_process_head_comment(emitter *yaml_emitter_t) bool {
 	if len(emitter.tail_comment) > 0 {
-		if !yaml_emitter_write_indent(emitter) {
-			return false
-		}
-		if !yaml_emitter_write_comment(emitter, emitter.tail_comment) {
+		if !yaml_emitter_write_comment_block(emitter, emitter.tail_comment) {
 			return false
 		}
 		emitter.tail_comment = emitter.tail_comment[:0]
@@ -1256,10 +1322,19 @@ func yaml_emitter_process_head_comment(emitter *yaml_emitter_t) bool {
 		}
 	}
 
-	if !yaml_emitter_write_indent(emitter) {
-		return false
+	if emitter.blank_after_head_comment {
+		comment := emitter.head_comment[:len(emitter.head_comment)-trailingNewlines]
+		if bytes.IndexByte(comment, '\n') >= 0 {
+			// Exactly one blank line follows comment blocks.
+			if !yaml_emitter_write_comment_block(emitter, comment) || !put_break(emitter) {
+				return false
+			}
+			emitter.head_comment = emitter.head_comment[:0]
+			return true
+		}
 	}
-	if !yaml_emitter_write_comment(emitter, emitter.head_comment) {
+
+	if !yaml_emitter_write_comment_block(emitter, emitter.head_comment) {
 		return false
 	}
 
@@ -1298,10 +1373,7 @@ func yaml_emitter_process_foot_comment(emitter *yaml_emitter_t) bool {
 	if len(emitter.foot_comment) == 0 {
 		return true
 	}
-	if !yaml_emitter_write_indent(emitter) {
-		return false
-	}
-	if !yaml_emitter_write_comment(emitter, emitter.foot_comment) {
+	if !yaml_emitter_write_comment_block(emitter, emitter.foot_comment) {
 		return false
 	}
 	emitter.foot_comment = emitter.foot_comment[:0]
@@ -1465,6 +1537,9 @@ func yaml_emitter_analyze_scalar(emitter *yaml_emitter_t, value []byte) bool {
 		} else if !is_printable(value, i) || !is_ascii(value, i) && !emitter.unicode {
 			special_characters = true
 		}
+		if _, ok := yaml_emitter_custom_escape(emitter, value, i); ok {
+			special_characters = true
+		}
 		if is_space(value, i) {
 			if i == 0 {
 				leading_space = true
@@ -1509,7 +1584,7 @@ func yaml_emitter_analyze_scalar(emitter *yaml_emitter_t, value []byte) bool {
 		emitter.scalar_data.flow_plain_allowed = false
 		emitter.scalar_data.block_plain_allowed = false
 	}
-	if trailing_space {
+	if trailing_space && !(emitter.multiline_literal && line_breaks) {
 		emitter.scalar_data.block_allowed = false
 	}
 	if break_space {
@@ -1522,7 +1597,7 @@ func yaml_emitter_analyze_scalar(emitter *yaml_emitter_t, value []byte) bool {
 		emitter.scalar_data.block_plain_allowed = false
 		emitter.scalar_data.single_quoted_allowed = false
 	}
-	if space_break || special_characters {
+	if space_break && !emitter.multiline_literal || special_characters {
 		emitter.scalar_data.block_allowed = false
 	}
 	if line_breaks {
@@ -1874,6 +1949,17 @@ func yaml_emitter_write_single_quoted_scalar(emitter *yaml_emitter_t, value []by
 	return true
 }
 
+// yaml_emitter_custom_escape returns the text to write for the character
+// at value[i] within double quotes, if one was set with
+// Encoder.SetEscapeFunc.
+func yaml_emitter_custom_escape(emitter *yaml_emitter_t, value []byte, i int) (string, bool) {
+	if emitter.escape_func == nil {
+		return "", false
+	}
+	r, _ := utf8.DecodeRune(value[i:])
+	return emitter.escape_func(r)
+}
+
 func yaml_emitter_write_double_quoted_scalar(emitter *yaml_emitter_t, value []byte, allow_breaks bool) bool {
 	spaces := false
 	if !yaml_emitter_write_indicator(emitter, []byte{'"'}, true, false, false) {
@@ -1881,6 +1967,14 @@ func yaml_emitter_write_double_quoted_scalar(emitter *yaml_emitter_t, value []by
 	}
 
 	for i := 0; i < len(value); {
+		if escape, ok := yaml_emitter_custom_escape(emitter, value, i); ok {
+			if !write_all(emitter, []byte(escape)) {
+				return false
+			}
+			i += width(value[i])
+			spaces = false
+			continue
+		}
 		if !is_printable(value, i) || (!emitter.unicode && !is_ascii(value, i)) ||
 			is_bom(value, i) || is_break(value, i) ||
 			value[i] == '"' || value[i] == '\\' {
@@ -1996,8 +2090,14 @@ func yaml_emitter_write_double_quoted_scalar(emitter *yaml_emitter_t, value []by
 }
 
 func yaml_emitter_write_block_scalar_hints(emitter *yaml_emitter_t, value []byte) bool {
-	if is_space(value, 0) || is_break(value, 0) {
-		indent_hint := []byte{'0' + byte(emitter.best_indent)}
+	if emitter.block_indent > 0 || is_space(value, 0) || is_break(value, 0) {
+		// The indentation indicator is relative to the indentation of
+		// the parent node, which is less than best_indent in sequences.
+		parent := emitter.indents[len(emitter.indents)-1]
+		if parent < 0 {
+			parent = 0
+		}
+		indent_hint := []byte{'0' + byte(emitter.indent-parent)}
 		if !yaml_emitter_write_indicator(emitter, indent_hint, false, false, false) {
 			return false
 		}
@@ -2030,9 +2130,11 @@ func yaml_emitter_write_block_scalar_hints(emitter *yaml_emitter_t, value []byte
 		}
 	}
 	if chomp_hint[0] != 0 {
+		open_ended := emitter.open_ended
 		if !yaml_emitter_write_indicator(emitter, chomp_hint[:], false, false, false) {
 			return false
 		}
+		emitter.open_ended = open_ended
 	}
 	return true
 }
@@ -2047,6 +2149,11 @@ func yaml_emitter_write_literal_scalar(emitter *yaml_emitter_t, value []byte) bo
 	if !yaml_emitter_process_line_comment(emitter) {
 		return false
 	}
+	// End the header line here, so that a leading line break in value
+	// is written as an empty line rather than ending the header.
+	if emitter.column > 0 && !put_break(emitter) {
+		return false
+	}
 	//emitter.indention = true
 	emitter.whitespace = true
 	breaks := true
@@ -2084,6 +2191,9 @@ func yaml_emitter_write_folded_scalar(emitter *yaml_emitter_t, value []byte) boo
 	if !yaml_emitter_process_line_comment(emitter) {
 		return false
 	}
+	if emitter.column > 0 && !put_break(emitter) {
+		return false
+	}
 
 	//emitter.indention = true
 	emitter.whitespace = true
@@ -2132,6 +2242,85 @@ func yaml_emitter_write_folded_scalar(emitter *yaml_emitter_t, value []byte) boo
 	return true
 }
 
+// Write a head or foot comment on lines of its own, indented as the
+// current node unless comments are written at the first column.
+func yaml_emitter_write_comment_block(emitter *yaml_emitter_t, comment []byte) bool {
+	// Leading line breaks are blank lines kept before the comment, and
+	// are written without indentation.
+	if len(comment) > 0 && comment[0] == '\n' {
+		if emitter.column > 0 && !put_break(emitter) {
+			return false
+		}
+		for len(comment) > 0 && comment[0] == '\n' {
+			if !put_break(emitter) {
+				return false
+			}
+			comment = comment[1:]
+		}
+		emitter.whitespace = true
+	}
+	indent := emitter.indent
+	// Comments following an indicator on the same line stay there.
+	if emitter.comments_flush_left && !(emitter.indention && emitter.column > 0 && emitter.column <= emitter.indent) {
+		emitter.indent = 0
+	}
+	if !yaml_emitter_write_indent(emitter) {
+		emitter.indent = indent
+		return false
+	}
+	if emitter.comment_width > 0 {
+		comment = yaml_emitter_wrap_comment(comment, emitter.column, emitter.comment_width)
+	}
+	ok := yaml_emitter_write_comment(emitter, comment)
+	emitter.indent = indent
+	return ok
+}
+
+// Wrap the lines of a comment starting at the given column which go past
+// the width at spaces between words. Words longer than the width, such as
+// long URLs, are kept whole.
+func yaml_emitter_wrap_comment(comment []byte, column, width int) []byte {
+	lines := bytes.Split(comment, []byte{'\n'})
+	var out []byte
+	for n, line := range lines {
+		if n > 0 {
+			out = append(out, '\n')
+		}
+		if column+utf8.RuneCount(line) <= width {
+			out = append(out, line...)
+			continue
+		}
+		prefix := []byte("# ")
+		if len(line) > 0 && line[0] == '#' {
+			i := 1
+			for i < len(line) && line[i] == ' ' {
+				i++
+			}
+			if i > 1 {
+				prefix = line[:i]
+			}
+			line = line[i:]
+		}
+		size := 0
+		for i, word := range bytes.Fields(line) {
+			wsize := utf8.RuneCount(word)
+			if i == 0 || column+size+1+wsize > width {
+				if i > 0 {
+					out = append(out, '\n')
+				}
+				out = append(out, prefix...)
+				size = utf8.RuneCount(prefix)
+			} else {
+				out = append(out, ' ')
+				size++
+			}
+			out = append(out, word...)
+			size += wsize
+		}
+	}
+	return out
+}
+
 func yaml_emitter_write_comment(emitter *yaml_emitter_t, comment []byte) bool {
 	breaks := false
 	pound := false
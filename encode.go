@@ -19,6 +19,8 @@ import (
 	"encoding"
 	"fmt"
 	"io"
+	"math/big"
+	"net/url"
 	"reflect"
 	"regexp"
 	"sort"
@@ -29,6 +31,8 @@ import (
 )
 
 type encoder struct {
+	encoderOptions
+
 	emitter            yaml_emitter_t
 	event              yaml_event_t
 	out                []byte
@@ -36,6 +40,70 @@ type encoder struct {
 	indent             int
 	doneInit           bool
 	preserveBlankLines bool
+	compactMerges      bool
+	maxItems           int
+
+	// spaceTopLevel enables rewriting the blank lines of documents so
+	// that only topLevelSpacing of them separate the top-level entries.
+	spaceTopLevel   bool
+	topLevelSpacing int
+
+	// verify enables checking that the text written for every document
+	// decodes back to the value encoded.
+	verify bool
+
+	// isKey tells whether the next event is the one of a key.
+	isKey bool
+
+	// refs counts the references to each pointer in the document being
+	// encoded with autoAnchors, anchors holds the names given so far, and
+	// anchor is the name to attach to the next node emitted. anchorCount
+	// is the number of anchors given so far.
+	refs        map[pointerKey]int
+	anchors     map[pointerKey]string
+	anchor      string
+	anchorCount int
+
+	// blockIndent is the indentation indicator to attach to the next
+	// scalar emitted, taken from the BlockIndent of nodes.
+	blockIndent int
+
+	// checkAnchorOrder enables failing on aliases written before the
+	// anchor they refer to. definedAnchors holds the anchors written so
+	// far in the stream.
+	checkAnchorOrder bool
+	definedAnchors   map[string]bool
+}
+
+// encoderOptions holds the settings of an encoder which act while values
+// are turned into events, so that tree may hand all of them over to the
+// encoder building the nodes to transform.
+type encoderOptions struct {
+	mapAsSeqOfPairs  bool
+	keepExplicitTags bool
+	explicitTags     bool
+	omitZero         bool
+	keywordCase      KeywordCase
+	normalization    NormalizationForm
+
+	// keyStyle is the style of quotes forced on keys, which is only
+	// applied to string keys unless quoteAllKeys is set. valueStyle is
+	// the one forced on string values.
+	keyStyle     yaml_scalar_style_t
+	quoteAllKeys bool
+	valueStyle   yaml_scalar_style_t
+
+	// autoAnchors enables anchoring values referenced by the same pointer
+	// more than once. anchorName names these anchors, if set.
+	autoAnchors bool
+	anchorName  func(i int) string
+}
+
+// pointerKey identifies the value referenced by a pointer. The type is
+// needed as a struct and its first field share the same address.
+type pointerKey struct {
+	ptr uintptr
+	typ reflect.Type
 }
 
 func newEncoder() *encoder {
@@ -84,10 +152,59 @@ func (e *encoder) destroy() {
 }
 
 func (e *encoder) emit() {
+	if e.event.typ == yaml_SCALAR_EVENT && (e.event.implicit || e.event.quoted_implicit) {
+		style, all := e.valueStyle, false
+		if e.isKey {
+			style, all = e.keyStyle, e.quoteAllKeys
+		}
+		if style != 0 {
+			switch e.event.scalar_style() {
+			case yaml_PLAIN_SCALAR_STYLE:
+				if rtag, _ := resolve("", string(e.event.value)); rtag == strTag || all {
+					e.event.style = yaml_style_t(style)
+				}
+			case yaml_SINGLE_QUOTED_SCALAR_STYLE, yaml_DOUBLE_QUOTED_SCALAR_STYLE:
+				e.event.style = yaml_style_t(style)
+			}
+		}
+	}
+	e.isKey = false
+	if e.anchor != "" {
+		switch e.event.typ {
+		case yaml_SCALAR_EVENT, yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+			e.event.anchor = []byte(e.anchor)
+			e.anchor = ""
+		}
+	}
+	if e.blockIndent != 0 && e.event.typ == yaml_SCALAR_EVENT {
+		e.event.block_indent = e.blockIndent
+		e.blockIndent = 0
+	}
+	if e.checkAnchorOrder {
+		e.checkAnchor()
+	}
 	// This will internally delete the e.event value.
 	e.must(yaml_emitter_emit(&e.emitter, &e.event))
 }
 
+// checkAnchor fails if the event to emit is an alias to an anchor not
+// written before it in the stream, where the decoder finds anchors.
+func (e *encoder) checkAnchor() {
+	if e.definedAnchors == nil || e.event.typ == yaml_STREAM_START_EVENT {
+		e.definedAnchors = make(map[string]bool)
+	}
+	switch e.event.typ {
+	case yaml_ALIAS_EVENT:
+		if name := string(e.event.anchor); !e.definedAnchors[name] {
+			failf("alias *%s is written before its anchor &%s is defined", name, name)
+		}
+	case yaml_SCALAR_EVENT, yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+		if len(e.event.anchor) > 0 {
+			e.definedAnchors[string(e.event.anchor)] = true
+		}
+	}
+}
+
 func (e *encoder) must(ok bool) {
 	if !ok {
 		msg := e.emitter.problem
@@ -100,13 +217,50 @@ func (e *encoder) must(ok bool) {
 
 func (e *encoder) marshalDoc(tag string, in reflect.Value) {
 	e.init()
+	if e.verify && e.emitter.output_writer != nil {
+		e.verifyDoc(tag, in)
+		return
+	}
 	var node *Node
 	if in.IsValid() {
 		node, _ = in.Interface().(*Node)
 	}
+	if e.compactMerges && (node == nil || node.Kind != DocumentNode) {
+		node = e.tree(tag, in)
+		compactMerges(node)
+		in = reflect.ValueOf(node)
+	}
+	if e.maxItems > 0 {
+		// Truncate a copy, as the value may hold nodes of the caller.
+		node = e.tree(tag, in)
+		truncateCollections(node, e.maxItems)
+		in = reflect.ValueOf(node)
+	}
+	if e.spaceTopLevel {
+		// Work on a copy, keeping the comments of documents given as nodes.
+		if node != nil && node.Kind == DocumentNode {
+			node = copyNode(node, make(map[*Node]*Node))
+		} else {
+			node = e.tree(tag, in)
+		}
+		spaceTopLevel(node, e.topLevelSpacing)
+		in = reflect.ValueOf(node)
+		// The spacing is only written with blank lines preserved.
+		preserve := e.preserveBlankLines
+		e.preserveBlankLines, e.emitter.preserve_blank_lines = true, true
+		defer func() {
+			e.preserveBlankLines, e.emitter.preserve_blank_lines = preserve, preserve
+		}()
+	}
 	if node != nil && node.Kind == DocumentNode {
 		e.nodev(in)
 	} else {
+		e.refs, e.anchors, e.anchor, e.anchorCount = nil, nil, "", 0
+		if e.autoAnchors {
+			e.refs = make(map[pointerKey]int)
+			e.anchors = make(map[pointerKey]string)
+			countRefs(in, e.refs)
+		}
 		yaml_document_start_event_initialize(&e.event, nil, nil, true)
 		e.emit()
 		e.marshal(tag, in)
@@ -115,6 +269,92 @@ func (e *encoder) marshalDoc(tag string, in reflect.Value) {
 	}
 }
 
+// tree returns the document node which in encodes to with the settings
+// of e, so that it may be transformed before being emitted. The
+// transformations themselves are left to the caller.
+func (e *encoder) tree(tag string, in reflect.Value) *Node {
+	sub := newEncoder()
+	defer sub.destroy()
+	sub.encoderOptions = e.encoderOptions
+	// The styles the emitter picks for scalars are kept in the tree.
+	sub.emitter.multiline_literal = e.emitter.multiline_literal
+	sub.marshalDoc(tag, in)
+	sub.finish()
+	p := newParser(sub.out)
+	p.textless = true
+	defer p.destroy()
+	return p.parse()
+}
+
+// truncateCollections walks the tree rooted at n and drops the items
+// of sequences and the entries of mappings beyond the first max ones,
+// noting how many were left out in a foot comment of the last one kept.
+func truncateCollections(n *Node, max int) {
+	if n.Kind == AliasNode {
+		return
+	}
+	size := 1
+	if n.Kind == MappingNode {
+		size = 2
+	}
+	if n.Kind == SequenceNode || n.Kind == MappingNode {
+		if more := len(n.Content)/size - max; more > 0 {
+			n.Content = n.Content[:max*size]
+			comment := "# ... " + strconv.Itoa(more) + " more"
+			if n.Style&FlowStyle != 0 {
+				// Comments can't be written within flow collections.
+				if n.LineComment == "" {
+					n.LineComment = comment
+				}
+			} else {
+				last := n.Content[max*size-size]
+				if last.FootComment != "" {
+					comment = last.FootComment + "\n" + comment
+				}
+				last.FootComment = comment
+			}
+		}
+	}
+	for _, c := range n.Content {
+		truncateCollections(c, max)
+	}
+}
+
+// copyNode returns a deep copy of the tree rooted at n, with aliases
+// pointing to the copies of their anchored nodes. seen maps the nodes
+// copied so far to their copies.
+func copyNode(n *Node, seen map[*Node]*Node) *Node {
+	if c, ok := seen[n]; ok {
+		return c
+	}
+	c := *n
+	seen[n] = &c
+	if n.Alias != nil {
+		c.Alias = copyNode(n.Alias, seen)
+	}
+	if n.Content != nil {
+		c.Content = make([]*Node, len(n.Content))
+		for i, child := range n.Content {
+			c.Content[i] = copyNode(child, seen)
+		}
+	}
+	return &c
+}
+
+// spaceTopLevel removes all the blank lines recorded in the document
+// rooted at doc and then separates the entries of its top-level mapping,
+// if any, with n blank lines.
+func spaceTopLevel(doc *Node, n int) {
+	doc.RemoveBlankLines()
+	if len(doc.Content) == 0 || doc.Content[0].Kind != MappingNode {
+		return
+	}
+	m := doc.Content[0]
+	for i := 2; i+1 < len(m.Content); i += 2 {
+		m.Content[i].BlankLinesBefore = n
+	}
+}
+
 func (e *encoder) marshal(tag string, in reflect.Value) {
 	tag = shortTag(tag)
 	if !in.IsValid() || in.Kind() == reflect.Ptr && in.IsNil() {
@@ -143,6 +383,24 @@ func (e *encoder) marshal(tag string, in reflect.Value) {
 	case time.Duration:
 		e.stringv(tag, reflect.ValueOf(value.String()))
 		return
+	case url.URL:
+		e.stringv(tag, reflect.ValueOf(value.String()))
+		return
+	case *url.URL:
+		e.stringv(tag, reflect.ValueOf(value.String()))
+		return
+	case *big.Int:
+		e.bigIntv(tag, value)
+		return
+	case big.Int:
+		e.bigIntv(tag, &value)
+		return
+	case *big.Float:
+		e.bigFloatv(tag, value)
+		return
+	case big.Float:
+		e.bigFloatv(tag, &value)
+		return
 	case Marshaler:
 		v, err := value.MarshalYAML()
 		if err != nil {
@@ -170,6 +428,9 @@ func (e *encoder) marshal(tag string, in reflect.Value) {
 	case reflect.Map:
 		e.mapv(tag, in)
 	case reflect.Ptr:
+		if e.refs[pointerKey{in.Pointer(), in.Type()}] > 1 && e.aliasv(in) {
+			return
+		}
 		e.marshal(tag, in.Elem())
 	case reflect.Struct:
 		e.structv(tag, in)
@@ -190,17 +451,116 @@ func (e *encoder) marshal(tag string, in reflect.Value) {
 	}
 }
 
+// aliasv emits an alias if the value referenced by the pointer in has
+// been encoded already, and reports whether it did so. Otherwise the value
+// is given an anchor name to be attached when it gets encoded.
+func (e *encoder) aliasv(in reflect.Value) bool {
+	key := pointerKey{in.Pointer(), in.Type()}
+	if name, ok := e.anchors[key]; ok {
+		if e.anchor != "" {
+			// Pointers to this pointer were given a name of their own,
+			// which is never written as they end up as this alias.
+			for k, v := range e.anchors {
+				if v == e.anchor {
+					e.anchors[k] = name
+				}
+			}
+			e.anchor = ""
+			e.anchorCount--
+		}
+		e.must(yaml_alias_event_initialize(&e.event, []byte(name)))
+		e.emit()
+		return true
+	}
+	if e.anchor == "" {
+		e.anchorCount++
+		if e.anchorName != nil {
+			e.anchor = e.anchorName(e.anchorCount)
+		} else {
+			e.anchor = fmt.Sprintf("id%03d", e.anchorCount)
+		}
+	}
+	// Pointers to pointers end up anchoring the same node.
+	e.anchors[key] = e.anchor
+	return false
+}
+
+// countRefs walks in and counts the references to each pointer found,
+// without descending into the values of pointers seen before.
+func countRefs(in reflect.Value, refs map[pointerKey]int) {
+	switch in.Kind() {
+	case reflect.Ptr:
+		if in.IsNil() {
+			return
+		}
+		key := pointerKey{in.Pointer(), in.Type()}
+		refs[key]++
+		if refs[key] == 1 {
+			countRefs(in.Elem(), refs)
+		}
+	case reflect.Interface:
+		countRefs(in.Elem(), refs)
+	case reflect.Struct:
+		t := in.Type()
+		for i := 0; i < in.NumField(); i++ {
+			if f := t.Field(i); f.PkgPath == "" || f.Anonymous {
+				countRefs(in.Field(i), refs)
+			}
+		}
+	case reflect.Map:
+		iter := in.MapRange()
+		for iter.Next() {
+			countRefs(iter.Value(), refs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < in.Len(); i++ {
+			countRefs(in.Index(i), refs)
+		}
+	}
+}
+
 func (e *encoder) mapv(tag string, in reflect.Value) {
+	if isSetType(in.Type()) {
+		e.setv(tag, in)
+		return
+	}
+	if e.mapAsSeqOfPairs {
+		e.pairsv(tag, in)
+		return
+	}
 	e.mappingv(tag, func() {
 		keys := keyList(in.MapKeys())
 		sort.Sort(keys)
 		for _, k := range keys {
+			e.isKey = true
 			e.marshal("", k)
 			e.marshal("", in.MapIndex(k))
 		}
 	})
 }
 
+// isSetType reports whether t is a map with empty struct values, which is
+// the usual way of declaring a set in Go.
+func isSetType(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Elem().Kind() == reflect.Struct && t.Elem().NumField() == 0
+}
+
+// setv encodes a set as a !!set, which is a mapping with null values.
+func (e *encoder) setv(tag string, in reflect.Value) {
+	if tag == "" {
+		tag = longTag(setTag)
+	}
+	e.mappingv(tag, func() {
+		keys := keyList(in.MapKeys())
+		sort.Sort(keys)
+		for _, k := range keys {
+			e.isKey = true
+			e.marshal("", k)
+			e.emitScalar("", "", "", yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+		}
+	})
+}
+
 func (e *encoder) fieldByIndex(v reflect.Value, index []int) (field reflect.Value) {
 	for _, num := range index {
 		for {
@@ -234,12 +594,19 @@ func (e *encoder) structv(tag string, in reflect.Value) {
 					continue
 				}
 			}
-			if info.OmitEmpty && isZero(value) {
+			if (info.OmitEmpty || e.omitZero && !info.KeepZero) && isZero(value) {
 				continue
 			}
+			e.isKey = true
 			e.marshal("", reflect.ValueOf(info.Key))
 			e.flow = info.Flow
-			e.marshal("", value)
+			if info.Bytes {
+				e.byteSizev(value)
+			} else if info.Epoch != 0 {
+				e.epochv(value, info.Epoch)
+			} else {
+				e.marshal("", value)
+			}
 		}
 		if sinfo.InlineMap >= 0 {
 			m := in.Field(sinfo.InlineMap)
@@ -251,6 +618,7 @@ func (e *encoder) structv(tag string, in reflect.Value) {
 					if _, found := sinfo.FieldsMap[k.String()]; found {
 						panic(fmt.Sprintf("cannot have key %q in inlined map: conflicts with struct field", k.String()))
 					}
+					e.isKey = true
 					e.marshal("", k)
 					e.flow = false
 					e.marshal("", m.MapIndex(k))
@@ -260,6 +628,67 @@ func (e *encoder) structv(tag string, in reflect.Value) {
 	})
 }
 
+// byteSizev encodes the integer in as a size in bytes with a suffix,
+// such as "256Mi", for fields with the bytes flag.
+func (e *encoder) byteSizev(in reflect.Value) {
+	for in.Kind() == reflect.Ptr && !in.IsNil() {
+		in = in.Elem()
+	}
+	size := new(big.Int)
+	switch in.Kind() {
+	case reflect.Ptr:
+		e.nilv()
+		return
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size.SetInt64(in.Int())
+	default:
+		size.SetUint64(in.Uint())
+	}
+	e.emitScalar(formatByteSize(size), "", "", yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+}
+
+// epochv encodes the time.Time in as an integer number of units since
+// the Unix epoch, for fields with the unix or unixmilli flags.
+func (e *encoder) epochv(in reflect.Value, unit time.Duration) {
+	for in.Kind() == reflect.Ptr && !in.IsNil() {
+		in = in.Elem()
+	}
+	if in.Kind() == reflect.Ptr {
+		e.nilv()
+		return
+	}
+	t := in.Interface().(time.Time)
+	v := t.Unix()
+	if unit == time.Millisecond {
+		v = t.UnixMilli()
+	}
+	e.emitScalar(strconv.FormatInt(v, 10), "", "", yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+}
+
+// pairsv encodes a map as a sequence of single-key mappings, one for each
+// of its entries in key order.
+func (e *encoder) pairsv(tag string, in reflect.Value) {
+	implicit := tag == ""
+	style := yaml_BLOCK_SEQUENCE_STYLE
+	if e.flow {
+		e.flow = false
+		style = yaml_FLOW_SEQUENCE_STYLE
+	}
+	e.must(yaml_sequence_start_event_initialize(&e.event, nil, []byte(tag), implicit, style))
+	e.emit()
+	keys := keyList(in.MapKeys())
+	sort.Sort(keys)
+	for _, k := range keys {
+		e.mappingv("", func() {
+			e.isKey = true
+			e.marshal("", k)
+			e.marshal("", in.MapIndex(k))
+		})
+	}
+	e.must(yaml_sequence_end_event_initialize(&e.event))
+	e.emit()
+}
+
 func (e *encoder) mappingv(tag string, f func()) {
 	implicit := tag == ""
 	style := yaml_BLOCK_MAPPING_STYLE
@@ -328,9 +757,20 @@ func isOldBool(s string) (result bool) {
 	}
 }
 
+// normalize rewrites s in the normalization form of the encoder, if any.
+// It must run before s is resolved to pick a style, as the form may turn
+// text that reads as a string into one that doesn't, such as full-width
+// digits into ASCII ones.
+func (e *encoder) normalize(s string) string {
+	if e.normalization == nil || !utf8.ValidString(s) {
+		return s
+	}
+	return e.normalization.String(s)
+}
+
 func (e *encoder) stringv(tag string, in reflect.Value) {
 	var style yaml_scalar_style_t
-	s := in.String()
+	s := e.normalize(in.String())
 	canUsePlain := true
 	switch {
 	case !utf8.ValidString(s):
@@ -349,7 +789,7 @@ func (e *encoder) stringv(tag string, in reflect.Value) {
 		// tag when encoded unquoted. If it doesn't,
 		// there's no need to quote it.
 		rtag, _ := resolve("", s)
-		canUsePlain = rtag == strTag && !(isBase60Float(s) || isOldBool(s))
+		canUsePlain = rtag == strTag && !(isBase60Float(s) || isOldBool(s) || s == "<<")
 	}
 	// Note: it's possible for user code to emit invalid YAML
 	// if they explicitly specify a tag and a string containing
@@ -363,6 +803,9 @@ func (e *encoder) stringv(tag string, in reflect.Value) {
 		}
 	case canUsePlain:
 		style = yaml_PLAIN_SCALAR_STYLE
+	case e.explicitTags && s != "" && s != "<<":
+		tag = strTag
+		style = yaml_PLAIN_SCALAR_STYLE
 	default:
 		style = yaml_DOUBLE_QUOTED_SCALAR_STYLE
 	}
@@ -370,13 +813,11 @@ func (e *encoder) stringv(tag string, in reflect.Value) {
 }
 
 func (e *encoder) boolv(tag string, in reflect.Value) {
-	var s string
+	s := "false"
 	if in.Bool() {
 		s = "true"
-	} else {
-		s = "false"
 	}
-	e.emitScalar(s, "", tag, yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+	e.emitScalar(e.keyword(s), "", tag, yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
 }
 
 func (e *encoder) intv(tag string, in reflect.Value) {
@@ -414,8 +855,41 @@ func (e *encoder) floatv(tag string, in reflect.Value) {
 	e.emitScalar(s, "", tag, yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
 }
 
+// bigIntv encodes x using its exact decimal representation, which is
+// resolved back losslessly when decoding into a big.Int.
+func (e *encoder) bigIntv(tag string, x *big.Int) {
+	e.emitScalar(x.String(), "", tag, yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+}
+
+// bigFloatv encodes x using the shortest decimal representation that
+// decodes back into the same value at the precision of x.
+func (e *encoder) bigFloatv(tag string, x *big.Float) {
+	s := x.Text('g', -1)
+	switch s {
+	case "+Inf":
+		s = ".inf"
+	case "-Inf":
+		s = "-.inf"
+	}
+	e.emitScalar(s, "", tag, yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+}
+
 func (e *encoder) nilv() {
-	e.emitScalar("null", "", "", yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+	e.emitScalar(e.keyword("null"), "", "", yaml_PLAIN_SCALAR_STYLE, nil, nil, nil, nil)
+}
+
+// keyword returns s, a boolean or null word, in the case set with
+// Encoder.SetKeywordCase.
+func (e *encoder) keyword(s string) string {
+	switch e.keywordCase {
+	case LowerCase:
+		return strings.ToLower(s)
+	case TitleCase:
+		return strings.ToUpper(s[:1]) + strings.ToLower(s[1:])
+	case UpperCase:
+		return strings.ToUpper(s)
+	}
+	return s
 }
 
 func (e *encoder) emitScalar(value, anchor, tag string, style yaml_scalar_style_t, head, line, foot, tail []byte) {
@@ -464,15 +938,20 @@ func (e *encoder) node(node *Node, tail string) {
 	var tag = node.Tag
 	var stag = shortTag(tag)
 	var forceQuoting bool
+	var value = e.normalize(node.Value)
 	if tag != "" && node.Style&TaggedStyle == 0 {
 		if node.Kind == ScalarNode {
-			if stag == strTag && node.Style&(SingleQuotedStyle|DoubleQuotedStyle|LiteralStyle|FoldedStyle) != 0 {
-				tag = ""
+			// Scalars in styles other than plain always resolve as strings,
+			// so the tag may only be dropped on them when it's !!str.
+			if node.Style&(SingleQuotedStyle|DoubleQuotedStyle|LiteralStyle|FoldedStyle) != 0 {
+				if stag == strTag {
+					tag = ""
+				}
 			} else {
-				rtag, _ := resolve("", node.Value)
-				if rtag == stag {
+				rtag, _ := resolve("", value)
+				if rtag == stag && !(stag == strTag && value == "<<") {
 					tag = ""
-				} else if stag == strTag {
+				} else if stag == strTag && !e.keepExplicitTags && !e.explicitTags {
 					tag = ""
 					forceQuoting = true
 				}
@@ -491,6 +970,21 @@ func (e *encoder) node(node *Node, tail string) {
 		}
 	}
 
+	if e.explicitTags && node.Kind == ScalarNode && tag == "" && (stag == "" || stag == strTag) &&
+		node.Style&(SingleQuotedStyle|DoubleQuotedStyle|LiteralStyle|FoldedStyle) == 0 &&
+		(isOldBool(value) || isBase60Float(value)) {
+		tag = strTag
+	}
+
+	// An untagged plain scalar that only resolves to something other than
+	// a string once normalized must be quoted to remain a string.
+	if node.Kind == ScalarNode && node.Tag == "" && value != node.Value {
+		if rtag, _ := resolve("", node.Value); rtag == strTag {
+			rtag, _ = resolve("", value)
+			forceQuoting = rtag != strTag
+		}
+	}
+
 	// Emit blank lines before the node if feature is enabled
 	if e.preserveBlankLines && node.BlankLinesBefore > 0 {
 		e.event.blank_lines_before = node.BlankLinesBefore
@@ -498,7 +992,11 @@ func (e *encoder) node(node *Node, tail string) {
 
 	switch node.Kind {
 	case DocumentNode:
-		yaml_document_start_event_initialize(&e.event, nil, nil, true)
+		var directives []yaml_tag_directive_t
+		for _, td := range node.TagDirectives {
+			directives = append(directives, yaml_tag_directive_t{handle: []byte(td.Handle), prefix: []byte(td.Prefix)})
+		}
+		yaml_document_start_event_initialize(&e.event, nil, directives, true)
 		e.event.head_comment = []byte(node.HeadComment)
 		if e.preserveBlankLines {
 			e.event.blank_lines_before = node.BlankLinesBefore
@@ -562,6 +1060,7 @@ func (e *encoder) node(node *Node, tail string) {
 				kopy.FootComment = ""
 				k = &kopy
 			}
+			e.isKey = true
 			e.node(k, tail)
 			tail = foot
 
@@ -590,7 +1089,6 @@ func (e *encoder) node(node *Node, tail string) {
 		e.emit()
 
 	case ScalarNode:
-		value := node.Value
 		if !utf8.ValidString(value) {
 			if stag == binaryTag {
 				failf("explicitly tagged !!binary data must be base64-encoded")
@@ -619,6 +1117,13 @@ func (e *encoder) node(node *Node, tail string) {
 		case forceQuoting:
 			style = yaml_DOUBLE_QUOTED_SCALAR_STYLE
 		}
+		if style == yaml_PLAIN_SCALAR_STYLE && e.keywordCase != KeepCase && value != "" && value != "~" {
+			if rtag, _ := resolve("", value); (rtag == boolTag || rtag == nullTag) && (stag == "" || stag == rtag) {
+				value = e.keyword(value)
+			}
+		}
+
+		e.blockIndent = node.BlockIndent
 
 		// Pass blank line information for scalars
 		if e.preserveBlankLines {
@@ -0,0 +1,123 @@
+package yaml
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GetString returns the string at path within the tree rooted at root.
+// The path holds mapping keys separated by dots and sequence indexes in
+// brackets, as in "spec.containers[0].name", with keys which aren't simple
+// words quoted in brackets, as in `labels["app.kubernetes.io/name"]`.
+// Paths are relative to the top-level value when root is a document, with
+// the empty path standing for that value, and aliases are followed. An
+// error is returned if there's no scalar at path, or if it can't be decoded
+// into a string. Nulls are returned as "".
+func GetString(root *Node, path string) (string, error) {
+	var v string
+	err := getPath(root, path, &v)
+	return v, err
+}
+
+// GetInt returns the integer at path within the tree rooted at root, as
+// described for GetString. Nulls are returned as zero.
+func GetInt(root *Node, path string) (int, error) {
+	var v int
+	err := getPath(root, path, &v)
+	return v, err
+}
+
+// GetBool returns the boolean at path within the tree rooted at root, as
+// described for GetString. Nulls are returned as false.
+func GetBool(root *Node, path string) (bool, error) {
+	var v bool
+	err := getPath(root, path, &v)
+	return v, err
+}
+
+// getPath decodes the scalar found at path within root into out.
+func getPath(root *Node, path string, out interface{}) error {
+	n, err := lookupNode(root, path)
+	if err != nil {
+		return err
+	}
+	if n.Kind != ScalarNode {
+		return fmt.Errorf("yaml: value at %s is not a scalar", path)
+	}
+	if err := n.Decode(out); err != nil {
+		return fmt.Errorf("yaml: value at %s: %s", path, strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	return nil
+}
+
+// lookupNode returns the node found at path within root, with paths as
+// described for GetString.
+func lookupNode(root *Node, path string) (*Node, error) {
+	n := root
+	if n.Kind == DocumentNode && len(n.Content) == 1 {
+		n = n.Content[0]
+	}
+	rest := path
+	for first := true; rest != ""; first = false {
+		if n.Kind == AliasNode && n.Alias != nil {
+			n = n.Alias
+		}
+		var key string
+		index := -1
+		switch {
+		case strings.HasPrefix(rest, "[\""):
+			quoted, err := strconv.QuotedPrefix(rest[1:])
+			if err != nil || !strings.HasPrefix(rest[1+len(quoted):], "]") {
+				return nil, errors.New("yaml: invalid path " + strconv.Quote(path))
+			}
+			key, _ = strconv.Unquote(quoted)
+			rest = rest[len(quoted)+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.IndexByte(rest, ']')
+			i, err := strconv.Atoi(rest[1:max(end, 1)])
+			if end < 0 || err != nil || i < 0 {
+				return nil, errors.New("yaml: invalid path " + strconv.Quote(path))
+			}
+			index, rest = i, rest[end+1:]
+		default:
+			if !first {
+				if !strings.HasPrefix(rest, ".") {
+					return nil, errors.New("yaml: invalid path " + strconv.Quote(path))
+				}
+				rest = rest[1:]
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, errors.New("yaml: invalid path " + strconv.Quote(path))
+			}
+			key, rest = rest[:end], rest[end:]
+		}
+
+		var next *Node
+		if index >= 0 {
+			if n.Kind == SequenceNode && index < len(n.Content) {
+				next = n.Content[index]
+			}
+		} else if n.Kind == MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if k := n.Content[i]; k.Kind == ScalarNode && k.Value == key {
+					next = n.Content[i+1]
+					break
+				}
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("yaml: path %s not found", path)
+		}
+		n = next
+	}
+	if n.Kind == AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	return n, nil
+}
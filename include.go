@@ -0,0 +1,65 @@
+package yaml
+
+import (
+	"strings"
+)
+
+// includeTag marks the scalars replaced by the document at their path
+// when an include resolver is set with Decoder.SetIncludeResolver.
+const includeTag = "!include"
+
+// maxIncludeDepth bounds the nesting of included documents, which would
+// otherwise be unlimited with a resolver producing new paths every time.
+const maxIncludeDepth = 64
+
+// resolveIncludes walks the tree rooted at n and replaces every node
+// tagged as !include by the node returned by resolve for its path. The
+// nodes included are resolved in turn, with chain holding the paths
+// of the documents being included, outermost first.
+func resolveIncludes(n *Node, resolve func(path string) (*Node, error), chain []string) {
+	if n.Kind == AliasNode {
+		return
+	}
+	if n.Tag != includeTag {
+		for _, c := range n.Content {
+			resolveIncludes(c, resolve, chain)
+		}
+		return
+	}
+	if n.Kind != ScalarNode {
+		failf("line %d: %s needs a scalar path", n.Line, includeTag)
+	}
+	path := n.Value
+	for _, p := range chain {
+		if p == path {
+			failf("line %d: include cycle: %s -> %s", n.Line, strings.Join(chain, " -> "), path)
+		}
+	}
+	if len(chain) == maxIncludeDepth {
+		failf("line %d: includes nested more than %d levels deep", n.Line, maxIncludeDepth)
+	}
+	included, err := resolve(path)
+	if err != nil {
+		failf("line %d: cannot include %s: %v", n.Line, path, err)
+	}
+	if included == nil {
+		failf("line %d: cannot include %s: no document", n.Line, path)
+	}
+	if included.Kind == DocumentNode {
+		if len(included.Content) == 0 {
+			failf("line %d: cannot include %s: empty document", n.Line, path)
+		}
+		included = included.Content[0]
+	}
+	// Each site gets a copy of its own, as resolvers may return the same
+	// nodes every time, and they are left as they are.
+	resolved := *copyNode(included, make(map[*Node]*Node))
+	resolveIncludes(&resolved, resolve, append(chain[:len(chain):len(chain)], path))
+	if resolved.HeadComment == "" {
+		resolved.HeadComment = n.HeadComment
+	}
+	if resolved.LineComment == "" {
+		resolved.LineComment = n.LineComment
+	}
+	*n = resolved
+}
@@ -0,0 +1,35 @@
+package yaml
+
+import (
+	"fmt"
+	"io"
+)
+
+// limitReader reads from r failing once more than limit bytes were read,
+// as set with Decoder.SetLimitBytes.
+type limitReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.read > l.limit {
+		return 0, l.err()
+	}
+	// Read one byte past the limit at most, to tell whether the input
+	// ends right at it.
+	if max := l.limit - l.read + 1; int64(len(p)) > max {
+		p = p[:max]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.limit {
+		return 0, l.err()
+	}
+	return n, err
+}
+
+func (l *limitReader) err() error {
+	return fmt.Errorf("input is larger than the limit of %d bytes", l.limit)
+}
@@ -126,3 +126,29 @@ func benchmark(b *testing.B, name string) {
 
 	b.Errorf("testcase %q not found", name)
 }
+
+func BenchmarkDecoderReset(b *testing.B) {
+	data := "name: web\nports: [80, 443]\nlabels: {app: web, tier: front}\n"
+	r := strings.NewReader(data)
+	dec := yaml.NewDecoder(r)
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		dec.Reset(r)
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewDecoder(b *testing.B) {
+	data := "name: web\nports: [80, 443]\nlabels: {app: web, tier: front}\n"
+	r := strings.NewReader(data)
+	for i := 0; i < b.N; i++ {
+		r.Reset(data)
+		var v interface{}
+		if err := yaml.NewDecoder(r).Decode(&v); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package yaml
+
+import (
+	"fmt"
+)
+
+// MapSlice is an ordered mapping which keeps the comments around each of
+// its entries, so that documents decoded into it can be encoded back with
+// their annotations in place.
+//
+// Mappings nested in the values of a MapSlice, directly or within
+// sequences, are decoded as MapSlice values as well. Other values are
+// decoded as they would be into an interface{}, and their own comments
+// are not kept.
+type MapSlice []MapItem
+
+// MapItem is an entry of a MapSlice.
+type MapItem struct {
+	Key, Value interface{}
+
+	// HeadComment holds the comments in the lines preceding the entry,
+	// LineComment the comment at the end of its first line, and
+	// FootComment the comments following it.
+	HeadComment string
+	LineComment string
+	FootComment string
+}
+
+// UnmarshalYAML implements the Unmarshaler interface.
+func (m *MapSlice) UnmarshalYAML(n *Node) error {
+	if n.Kind == AliasNode {
+		n = n.Alias
+	}
+	if n.Kind != MappingNode {
+		return &TypeError{[]string{fmt.Sprintf("line %d: cannot unmarshal %s into yaml.MapSlice", n.Line, n.ShortTag())}}
+	}
+	items := make(MapSlice, 0, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		item := MapItem{
+			HeadComment: k.HeadComment,
+			LineComment: k.LineComment,
+			FootComment: k.FootComment,
+		}
+		if item.LineComment == "" {
+			item.LineComment = v.LineComment
+		}
+		if err := k.Decode(&item.Key); err != nil {
+			return err
+		}
+		value, err := mapSliceValue(v)
+		if err != nil {
+			return err
+		}
+		item.Value = value
+		items = append(items, item)
+	}
+	*m = items
+	return nil
+}
+
+// mapSliceValue decodes n into an interface{}, turning any mappings
+// found into MapSlice values.
+func mapSliceValue(n *Node) (interface{}, error) {
+	switch n.Kind {
+	case MappingNode:
+		var m MapSlice
+		err := m.UnmarshalYAML(n)
+		return m, err
+	case SequenceNode:
+		s := make([]interface{}, len(n.Content))
+		for i, c := range n.Content {
+			v, err := mapSliceValue(c)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = v
+		}
+		return s, nil
+	}
+	var v interface{}
+	err := n.Decode(&v)
+	return v, err
+}
+
+// MarshalYAML implements the Marshaler interface.
+func (m MapSlice) MarshalYAML() (interface{}, error) {
+	n := &Node{Kind: MappingNode}
+	for _, item := range m {
+		k := &Node{}
+		if err := k.Encode(item.Key); err != nil {
+			return nil, err
+		}
+		v, err := mapSliceNode(item.Value)
+		if err != nil {
+			return nil, err
+		}
+		k.HeadComment = item.HeadComment
+		k.FootComment = item.FootComment
+		if v.Kind == ScalarNode {
+			v.LineComment = item.LineComment
+		} else {
+			k.LineComment = item.LineComment
+		}
+		n.Content = append(n.Content, k, v)
+	}
+	return n, nil
+}
+
+// mapSliceNode encodes v into a node, keeping the comments of any MapSlice
+// values found. These would be lost by Node.Encode when they end up at the
+// top of the document, as they'd be taken as the head of the document.
+func mapSliceNode(v interface{}) (*Node, error) {
+	switch v := v.(type) {
+	case MapSlice:
+		n, err := v.MarshalYAML()
+		if err != nil {
+			return nil, err
+		}
+		return n.(*Node), nil
+	case []interface{}:
+		n := &Node{Kind: SequenceNode}
+		for _, e := range v {
+			c, err := mapSliceNode(e)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, c)
+		}
+		return n, nil
+	}
+	n := &Node{}
+	err := n.Encode(v)
+	return n, err
+}
@@ -0,0 +1,147 @@
+package yaml
+
+import (
+	"strconv"
+)
+
+// compactMerges walks the tree rooted at n looking for sibling mappings,
+// either items of a sequence or values of a mapping, which share at least
+// two identical entries. The shared entries are moved into an anchored
+// mapping merged into the first of them, and the others merge it through
+// an alias, so that the document still decodes to the same values.
+func compactMerges(n *Node) {
+	anchors := make(map[string]bool)
+	collectAnchors(n, anchors)
+	compactNodeMerges(n, anchors)
+}
+
+func collectAnchors(n *Node, anchors map[string]bool) {
+	if n.Anchor != "" {
+		anchors[n.Anchor] = true
+	}
+	if n.Kind == AliasNode {
+		return
+	}
+	for _, c := range n.Content {
+		collectAnchors(c, anchors)
+	}
+}
+
+func compactNodeMerges(n *Node, anchors map[string]bool) {
+	var siblings []*Node
+	switch n.Kind {
+	case SequenceNode:
+		siblings = n.Content
+	case MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			siblings = append(siblings, n.Content[i])
+		}
+	case DocumentNode:
+	default:
+		return
+	}
+	var group []*Node
+	for _, s := range siblings {
+		if mergeCandidate(s) {
+			group = append(group, s)
+		}
+	}
+	if len(group) > 1 {
+		factorMerge(group, anchors)
+	}
+	for _, c := range n.Content {
+		compactNodeMerges(c, anchors)
+	}
+}
+
+// mergeCandidate returns whether the entries of n may be moved into
+// a merged mapping without changing the decoded value.
+func mergeCandidate(n *Node) bool {
+	if n.Kind != MappingNode || n.Style&FlowStyle != 0 || n.ShortTag() != mapTag {
+		return false
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k := n.Content[i]
+		if k.Kind != ScalarNode || isMerge(k) {
+			return false
+		}
+	}
+	return true
+}
+
+// factorMerge moves the entries common to all mappings in group into
+// a mapping anchored in the first of them.
+func factorMerge(group []*Node, anchors map[string]bool) {
+	first := group[0]
+	var shared []int
+	for i := 0; i+1 < len(first.Content); i += 2 {
+		found := true
+		for _, m := range group[1:] {
+			if mappingEntry(m, first.Content[i], first.Content[i+1]) < 0 {
+				found = false
+				break
+			}
+		}
+		if found {
+			shared = append(shared, i)
+		}
+	}
+	if len(shared) < 2 {
+		return
+	}
+
+	name := "base"
+	for i := 2; anchors[name]; i++ {
+		name = "base" + strconv.Itoa(i)
+	}
+	anchors[name] = true
+	base := &Node{Kind: MappingNode, Tag: mapTag, Anchor: name}
+	for _, i := range shared {
+		base.Content = append(base.Content, first.Content[i], first.Content[i+1])
+	}
+	for j, m := range group {
+		value := base
+		if j > 0 {
+			value = &Node{Kind: AliasNode, Value: name, Alias: base}
+		}
+		content := []*Node{{Kind: ScalarNode, Value: "<<"}, value}
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if mappingEntry(base, m.Content[i], m.Content[i+1]) < 0 {
+				content = append(content, m.Content[i], m.Content[i+1])
+			}
+		}
+		m.Content = content
+	}
+}
+
+// mappingEntry returns the index of the key in m equal to k and holding
+// a value equal to v, or -1 if there's no such entry.
+func mappingEntry(m, k, v *Node) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if nodesEqual(m.Content[i], k, true) && nodesEqual(m.Content[i+1], v, true) {
+			return i
+		}
+	}
+	return -1
+}
+
+// nodesEqual returns whether a and b represent the same value, regardless
+// of their style and comments. Tags are only compared if tags is set, as
+// mapping keys are repeated when written the same whatever their tags.
+func nodesEqual(a, b *Node, tags bool) bool {
+	if a == b {
+		return true
+	}
+	if a.Kind != b.Kind || tags && a.ShortTag() != b.ShortTag() || a.Value != b.Value || len(a.Content) != len(b.Content) {
+		return false
+	}
+	if a.Kind == AliasNode {
+		return a.Alias == b.Alias
+	}
+	for i := range a.Content {
+		if !nodesEqual(a.Content[i], b.Content[i], tags) {
+			return false
+		}
+	}
+	return true
+}
@@ -24,6 +24,7 @@ import (
 	. "gopkg.in/check.v1"
 	"io"
 	"strings"
+	"time"
 )
 
 var nodeTests = []struct {
@@ -2848,6 +2849,1028 @@ func (s *S) TestNodeOmitEmpty(c *C) {
 	c.Assert(err, ErrorMatches, "yaml: cannot encode node with unknown kind 0")
 }
 
+func (s *S) TestMarshalNode(c *C) {
+	data := "# head\na:\n  - 1\n\n  - 2\n\nb: {c: d} # line\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetPreserveBlankLines(true)
+	var n yaml.Node
+	err := dec.Decode(&n)
+	c.Assert(err, IsNil)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	enc.SetPreserveBlankLines(true)
+	err = enc.Encode(&n)
+	c.Assert(err, IsNil)
+	c.Assert(enc.Close(), IsNil)
+
+	out, err := yaml.MarshalNode(&n, yaml.WithIndent(2), yaml.WithPreserveBlankLines(true))
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, buf.String())
+	c.Assert(string(out), Equals, data)
+
+	// Without options the output matches Marshal.
+	out, err = yaml.MarshalNode(&n)
+	c.Assert(err, IsNil)
+	want, err := yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, string(want))
+
+	_, err = yaml.MarshalNode(&yaml.Node{Kind: 42})
+	c.Assert(err, ErrorMatches, "yaml: cannot encode node with unknown kind 42")
+}
+
+func (s *S) TestMergeComments(c *C) {
+	previous := "" +
+		"# Service settings.\n" +
+		"name: old # Line of name.\n" +
+		"# Removed.\n" +
+		"gone: 1\n" +
+		"ports:\n" +
+		"    # First port.\n" +
+		"    - 80\n" +
+		"    - 443 # TLS.\n"
+	var prev yaml.Node
+	err := yaml.Unmarshal([]byte(previous), &prev)
+	c.Assert(err, IsNil)
+
+	var gen yaml.Node
+	err = gen.Encode(map[string]interface{}{
+		"name":  "new",
+		"ports": []int{8080, 8443, 9090},
+		"added": true,
+	})
+	c.Assert(err, IsNil)
+	gen.Content[0].HeadComment = "# Added by the generator."
+
+	yaml.MergeComments(&gen, &prev)
+	out, err := yaml.Marshal(&gen)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, ""+
+		"# Added by the generator.\n"+
+		"added: true\n"+
+		"# Service settings.\n"+
+		"name: new # Line of name.\n"+
+		"ports:\n"+
+		"    # First port.\n"+
+		"    - 8080\n"+
+		"    - 8443 # TLS.\n"+
+		"    - 9090\n")
+}
+
+func (s *S) TestDocumentFootComment(c *C) {
+	tests := []string{
+		"a: 1\nb:\n    c: 2\n\n# Footer.\n",
+		"- a\n- b # Line.\n\n# Footer,\n# on two lines.\n",
+		"a: |+\n    text\n\n# Footer.\n",
+		"|+\n    text\n\n\n# Footer.\n",
+		"a: |\n    text\n\n# Footer.\n",
+	}
+	for _, data := range tests {
+		var n yaml.Node
+		c.Assert(yaml.Unmarshal([]byte(data), &n), IsNil)
+		c.Assert(n.FootComment, Not(Equals), "", Commentf("data: %q", data))
+		out, err := yaml.Marshal(&n)
+		c.Assert(err, IsNil)
+		c.Assert(string(out), Equals, data)
+	}
+
+	// The footer goes after the content, and before the next document.
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	for _, data := range []string{"a: |+\n  text\n\n", "b: 2\n"} {
+		var n yaml.Node
+		c.Assert(yaml.Unmarshal([]byte(data), &n), IsNil)
+		n.FootComment = "# Footer."
+		c.Assert(enc.Encode(&n), IsNil)
+	}
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, "a: |+\n    text\n\n# Footer.\n---\nb: 2\n\n# Footer.\n")
+	dec := yaml.NewDecoder(&buf)
+	for _, want := range []string{"text\n\n", "2"} {
+		var n yaml.Node
+		c.Assert(dec.Decode(&n), IsNil)
+		c.Assert(n.FootComment, Equals, "# Footer.")
+		c.Assert(n.Content[0].Content[1].Value, Equals, want)
+	}
+}
+
+func (s *S) TestNodeTagImplicit(c *C) {
+	var n yaml.Node
+	err := yaml.Unmarshal([]byte("a: !!str 1\nb: 2\nc: !!int 3\nd: \"4\"\ne: !point {x: 1}\nf: [5]\n"), &n)
+	c.Assert(err, IsNil)
+	m := n.Content[0]
+	for i, want := range []struct {
+		tag      string
+		implicit bool
+	}{
+		{"!!str", false},
+		{"!!int", true},
+		{"!!int", false},
+		{"!!str", true},
+		{"!point", false},
+		{"!!seq", true},
+	} {
+		v := m.Content[2*i+1]
+		c.Assert(v.ShortTag(), Equals, want.tag, Commentf("value %d", i))
+		c.Assert(v.TagImplicit(), Equals, want.implicit, Commentf("value %d", i))
+	}
+
+	// Only explicit tags are written back.
+	out, err := yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "a: !!str 1\nb: 2\nc: !!int 3\nd: \"4\"\ne: !point {x: 1}\nf: [5]\n")
+
+	c.Assert((&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "x"}).TagImplicit(), Equals, true)
+	c.Assert((&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "x", Style: yaml.TaggedStyle}).TagImplicit(), Equals, false)
+}
+
+func (s *S) TestTagDirectives(c *C) {
+	data := "" +
+		"%TAG !e! tag:example.com,2024:\n" +
+		"---\n" +
+		"a: !e!foo bar\n" +
+		"b: !e!baz\n" +
+		"    c: !local 1\n" +
+		"---\n" +
+		"!<tag:example.com,2024:foo> x\n"
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	var first, second yaml.Node
+	c.Assert(dec.Decode(&first), IsNil)
+	c.Assert(dec.Decode(&second), IsNil)
+	c.Assert(first.TagDirectives, DeepEquals, []yaml.TagDirective{{Handle: "!e!", Prefix: "tag:example.com,2024:"}})
+	c.Assert(first.Content[0].Content[1].Tag, Equals, "tag:example.com,2024:foo")
+	c.Assert(second.TagDirectives, IsNil)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	c.Assert(enc.Encode(&first), IsNil)
+	c.Assert(enc.Encode(&second), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		"%TAG !e! tag:example.com,2024:\n"+
+		"---\n"+
+		"a: !e!foo bar\n"+
+		"b: !e!baz\n"+
+		"    c: !local 1\n"+
+		"---\n"+
+		"!<tag:example.com,2024:foo> x\n")
+
+	second.TagDirectives = []yaml.TagDirective{{Handle: "e", Prefix: "tag:example.com,2024:"}}
+	_, err := yaml.Marshal(&second)
+	c.Assert(err, ErrorMatches, "yaml: tag handle must start with '!'")
+}
+
+func (s *S) TestGetters(c *C) {
+	data := "" +
+		"server:\n" +
+		"  port: 8080\n" +
+		"  host: &host example.com\n" +
+		"  tls: true\n" +
+		"  empty:\n" +
+		"backends:\n" +
+		"  - name: a\n" +
+		"    host: *host\n" +
+		"labels:\n" +
+		"  app.kubernetes.io/name: web\n"
+	var root yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(data), &root), IsNil)
+
+	port, err := yaml.GetInt(&root, "server.port")
+	c.Assert(err, IsNil)
+	c.Assert(port, Equals, 8080)
+	tls, err := yaml.GetBool(&root, "server.tls")
+	c.Assert(err, IsNil)
+	c.Assert(tls, Equals, true)
+	host, err := yaml.GetString(&root, "backends[0].host")
+	c.Assert(err, IsNil)
+	c.Assert(host, Equals, "example.com")
+	name, err := yaml.GetString(root.Content[0], `labels["app.kubernetes.io/name"]`)
+	c.Assert(err, IsNil)
+	c.Assert(name, Equals, "web")
+	empty, err := yaml.GetString(&root, "server.empty")
+	c.Assert(err, IsNil)
+	c.Assert(empty, Equals, "")
+	str, err := yaml.GetString(&root, "server.port")
+	c.Assert(err, IsNil)
+	c.Assert(str, Equals, "8080")
+
+	_, err = yaml.GetInt(&root, "server.missing")
+	c.Assert(err, ErrorMatches, "yaml: path server.missing not found")
+	_, err = yaml.GetInt(&root, "backends[1].name")
+	c.Assert(err, ErrorMatches, `yaml: path backends\[1\].name not found`)
+	_, err = yaml.GetInt(&root, "server.host")
+	c.Assert(err, ErrorMatches, "yaml: value at server.host: unmarshal errors:\n  line 3: cannot unmarshal !!str `example...` into int")
+	_, err = yaml.GetString(&root, "server")
+	c.Assert(err, ErrorMatches, "yaml: value at server is not a scalar")
+	_, err = yaml.GetString(&root, "server..port")
+	c.Assert(err, ErrorMatches, `yaml: invalid path "server..port"`)
+	_, err = yaml.GetString(&root, "backends[x]")
+	c.Assert(err, ErrorMatches, `yaml: invalid path "backends\[x\]"`)
+}
+
+func (s *S) TestEncoderKeepExplicitTags(c *C) {
+	data := "version: !!str 1.0\nname: !!str plain\ncount: !!int 3\n"
+	var n yaml.Node
+	err := yaml.Unmarshal([]byte(data), &n)
+	c.Assert(err, IsNil)
+	c.Assert(n.Content[0].Content[1].Tag, Equals, "!!str")
+
+	encode := func(n *yaml.Node, keep bool) string {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetKeepExplicitTags(keep)
+		c.Assert(enc.Encode(n), IsNil)
+		c.Assert(enc.Close(), IsNil)
+		return buf.String()
+	}
+	c.Assert(encode(&n, false), Equals, data)
+	c.Assert(encode(&n, true), Equals, data)
+
+	// Without TaggedStyle the tag is only kept when asked to.
+	built := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Value: "version"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "1.0"},
+		{Kind: yaml.ScalarNode, Value: "name"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "plain"},
+	}}
+	c.Assert(encode(built, false), Equals, "version: \"1.0\"\nname: plain\n")
+	c.Assert(encode(built, true), Equals, "version: !!str 1.0\nname: plain\n")
+}
+
+func (s *S) TestMarshalPreserving(c *C) {
+	data := "# Server settings.\n" +
+		"server:\n" +
+		"    host:   'example.com'   # public name\n" +
+		"    port: 8080\n" +
+		"\n" +
+		"    tags: [web, \"edge\" ,  eu]\n" +
+		"    script: |\n" +
+		"        echo start\n" +
+		"\n" +
+		"    name: caf\u00e9 # unicode\n" +
+		"...\n"
+
+	var n yaml.Node
+	c.Assert(yaml.UnmarshalPreserving([]byte(data), &n), IsNil)
+	out, err := yaml.MarshalPreserving(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, data)
+
+	server := n.Content[0].Content[1]
+	server.Content[3].Value = "9090"
+	out, err = yaml.MarshalPreserving(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, strings.Replace(data, "8080", "9090", 1))
+
+	server.Content[1].Value = "example.org"
+	server.Content[5].Content[2].Value = "eu, us"
+	server.Content[7].Value = "echo one\necho two\n"
+	server.Content[9] = &yaml.Node{Kind: yaml.ScalarNode, Value: "bar"}
+	out, err = yaml.MarshalPreserving(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "# Server settings.\n"+
+		"server:\n"+
+		"    host:   'example.org'   # public name\n"+
+		"    port: 9090\n"+
+		"\n"+
+		"    tags: [web, \"edge\" ,  \"eu, us\"]\n"+
+		"    script: |\n"+
+		"        echo one\n"+
+		"        echo two\n"+
+		"\n"+
+		"    name: bar # unicode\n"+
+		"...\n")
+
+	// Changes to the structure can't be applied to the text.
+	server.Content = server.Content[:4]
+	out, err = yaml.MarshalPreserving(&n)
+	c.Assert(err, IsNil)
+	want, err := yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, string(want))
+}
+
+func (s *S) TestNodeSortSequence(c *C) {
+	data := "items:\n" +
+		"  # Charlie's entry.\n" +
+		"  - name: charlie\n" +
+		"    port: 3\n" +
+		"  - name: alpha # first\n" +
+		"    port: 1\n" +
+		"  # Bravo's entry.\n" +
+		"  - name: bravo\n" +
+		"    port: 2\n"
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(data), &n), IsNil)
+	items := n.Content[0].Content[1]
+	items.SortSequence("name", nil)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	c.Assert(enc.Encode(&n), IsNil)
+	c.Assert(buf.String(), Equals, "items:\n"+
+		"  - name: alpha # first\n"+
+		"    port: 1\n"+
+		"  # Bravo's entry.\n"+
+		"  - name: bravo\n"+
+		"    port: 2\n"+
+		"  # Charlie's entry.\n"+
+		"  - name: charlie\n"+
+		"    port: 3\n")
+
+	// Custom orderings, nested paths, and items lacking the key.
+	c.Assert(yaml.Unmarshal([]byte("- {m: {v: 10}}\n- {x: 1}\n- {m: {v: 9}}\n- {m: {v: 100}}\n"), &n), IsNil)
+	n.Content[0].SortSequence("m.v", func(a, b *yaml.Node) bool {
+		var x, y int
+		a.Decode(&x)
+		b.Decode(&y)
+		return x < y
+	})
+	var v []map[string]interface{}
+	c.Assert(n.Decode(&v), IsNil)
+	c.Assert(v, DeepEquals, []map[string]interface{}{
+		{"m": map[string]interface{}{"v": 9}},
+		{"m": map[string]interface{}{"v": 10}},
+		{"m": map[string]interface{}{"v": 100}},
+		{"x": 1},
+	})
+
+	// Paths take the syntax of GetString.
+	c.Assert(yaml.Unmarshal([]byte("- {l: {a.b: [z, 2]}}\n- {l: {a.b: [y, 1]}}\n"), &n), IsNil)
+	n.Content[0].SortSequence(`l["a.b"][1]`, nil)
+	c.Assert(n.Decode(&v), IsNil)
+	c.Assert(v[0]["l"], DeepEquals, map[string]interface{}{"a.b": []interface{}{"y", 1}})
+	c.Assert(yaml.Unmarshal([]byte("[c, a, b]"), &n), IsNil)
+	n.Content[0].SortSequence("", nil)
+	var flat []string
+	c.Assert(n.Decode(&flat), IsNil)
+	c.Assert(flat, DeepEquals, []string{"a", "b", "c"})
+}
+
+func (s *S) TestNodeEmptyStringAndNull(c *C) {
+	tests := []struct {
+		data, want string
+	}{
+		{"a: \"\"\nb: ''\nc:\n", ""},
+		{"- \"\"\n- ''\n-\n", ""},
+		{"f: [\"\", '', ~]\n", ""},
+		{"f: {a: \"\", b: '', c: }\n", "f: {a: \"\", b: '', c: null}\n"},
+		{"? \n: x\n", "null: x\n"},
+	}
+	for _, t := range tests {
+		var n yaml.Node
+		c.Assert(yaml.Unmarshal([]byte(t.data), &n), IsNil)
+		out, err := yaml.Marshal(&n)
+		c.Assert(err, IsNil)
+		want := t.want
+		if want == "" {
+			want = t.data
+		}
+		c.Assert(string(out), Equals, want)
+
+		var v, back interface{}
+		c.Assert(yaml.Unmarshal([]byte(t.data), &v), IsNil)
+		c.Assert(yaml.Unmarshal(out, &back), IsNil)
+		c.Assert(back, DeepEquals, v)
+	}
+
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("[\"\", '', ]"), &n), IsNil)
+	items := n.Content[0].Content
+	c.Assert(items, HasLen, 2)
+	c.Assert(items[0].Tag, Equals, "!!str")
+	c.Assert(items[0].Style, Equals, yaml.DoubleQuotedStyle)
+	c.Assert(items[1].Tag, Equals, "!!str")
+	c.Assert(items[1].Style, Equals, yaml.SingleQuotedStyle)
+	c.Assert(yaml.Unmarshal([]byte("a:"), &n), IsNil)
+	c.Assert(n.Content[0].Content[1].Tag, Equals, "!!null")
+	c.Assert(n.Content[0].Content[1].Style, Equals, yaml.Style(0))
+}
+
+func (s *S) TestParseAnchorGraph(c *C) {
+	data := "defaults: &defaults\n" +
+		"  timeout: 5\n" +
+		"server: &server\n" +
+		"  <<: *defaults\n" +
+		"  port: 80\n" +
+		"primary: *server\n" +
+		"backup: *server\n"
+	g, err := yaml.ParseAnchorGraph([]byte(data))
+	c.Assert(err, IsNil)
+	c.Assert(g.Anchors, HasLen, 2)
+
+	defaults, server := g.Anchors[0], g.Anchors[1]
+	c.Assert(defaults.Name, Equals, "defaults")
+	c.Assert([]int{defaults.Line, defaults.Column}, DeepEquals, []int{1, 11})
+	c.Assert(defaults.Aliases, HasLen, 1)
+	c.Assert(defaults.Aliases[0].Line, Equals, 4)
+	c.Assert(defaults.Uses, HasLen, 0)
+
+	c.Assert(server.Name, Equals, "server")
+	c.Assert([]int{server.Line, server.Column}, DeepEquals, []int{3, 9})
+	c.Assert(server.Aliases, HasLen, 2)
+	c.Assert(server.Aliases[0].Line, Equals, 6)
+	c.Assert(server.Aliases[1].Line, Equals, 7)
+	c.Assert(server.Uses, DeepEquals, []*yaml.Anchor{defaults})
+	c.Assert(g.HasCycles(), Equals, false)
+
+	g, err = yaml.ParseAnchorGraph([]byte("a: &a\n  b: &b [x, *a]\n"))
+	c.Assert(err, IsNil)
+	c.Assert(g.Anchors, HasLen, 2)
+	c.Assert(g.Anchors[0].Cyclic, Equals, true)
+	c.Assert(g.Anchors[1].Cyclic, Equals, false)
+	c.Assert(g.HasCycles(), Equals, true)
+
+	_, err = yaml.ParseAnchorGraph([]byte("a: *missing\n"))
+	c.Assert(err, ErrorMatches, "yaml: unknown anchor 'missing' referenced")
+}
+
+func (s *S) TestNodeIsNull(c *C) {
+	tests := []struct {
+		data string
+		null bool
+		zero bool
+	}{
+		{"~", true, true},
+		{"null", true, true},
+		{"Null", true, true},
+		{"NULL", true, true},
+		{"a:", true, true},
+		{"!!null ''", true, true},
+		{"'null'", false, false},
+		{"!!str ~", false, false},
+		{"nil", false, false},
+		{"''", false, true},
+		{"false", false, true},
+		{"0", false, true},
+		{"0.0", false, true},
+		{"!!float 0", false, true},
+		{"1", false, false},
+		{"[]", false, true},
+		{"{}", false, true},
+		{"[~]", false, false},
+		{"a: &a ~\nb: *a", true, true},
+	}
+	for _, t := range tests {
+		var n yaml.Node
+		c.Assert(yaml.Unmarshal([]byte(t.data), &n), IsNil)
+		v := n.Content[0]
+		if v.Kind == yaml.MappingNode && len(v.Content) > 0 {
+			v = v.Content[len(v.Content)-1]
+		}
+		c.Assert(v.IsNull(), Equals, t.null, Commentf("data: %q", t.data))
+		c.Assert(v.IsZeroValue(), Equals, t.zero, Commentf("data: %q", t.data))
+	}
+	c.Assert((&yaml.Node{}).IsNull(), Equals, true)
+}
+
+func (s *S) TestNodeEqualValue(c *C) {
+	type server struct {
+		Host  string
+		Ports []int
+	}
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("host: example.com\nports: [80, 443]\n"), &n), IsNil)
+	m := n.Content[0]
+	c.Assert(m.EqualValue(server{"example.com", []int{80, 443}}), Equals, true)
+	c.Assert(m.EqualValue(&server{"example.com", []int{80, 443}}), Equals, true)
+	c.Assert(m.EqualValue(map[string]interface{}{"host": "example.com", "ports": []interface{}{80, 443}}), Equals, true)
+	c.Assert(m.EqualValue(server{"example.com", []int{80}}), Equals, false)
+	c.Assert(m.EqualValue(server{"example.org", []int{80, 443}}), Equals, false)
+	c.Assert(m.EqualValue(nil), Equals, false)
+	c.Assert(m.EqualValue("example.com"), Equals, false)
+	c.Assert(m.Content[1].EqualValue("example.com"), Equals, true)
+
+	c.Assert(yaml.Unmarshal([]byte("~"), &n), IsNil)
+	c.Assert(n.Content[0].EqualValue(nil), Equals, true)
+	c.Assert(n.Content[0].EqualValue(""), Equals, true)
+}
+
+func (s *S) TestNodeFindAll(c *C) {
+	data := "created: 2001-12-14\n" +
+		"events:\n" +
+		"  - at: 2002-01-01T10:00:00Z\n" +
+		"    name: start\n" +
+		"  - at: !!str 2003-01-01\n" +
+		"    when: &w 2004-01-01\n" +
+		"  - {at: [1, 2004-02-02]}\n" +
+		"last: *w\n"
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(data), &n), IsNil)
+
+	found := n.FindAll(func(n *yaml.Node) bool {
+		return n.Kind == yaml.ScalarNode && n.ShortTag() == "!!timestamp"
+	})
+	var values []string
+	for _, f := range found {
+		values = append(values, fmt.Sprintf("%d:%s", f.Line, f.Value))
+	}
+	c.Assert(values, DeepEquals, []string{"1:2001-12-14", "3:2002-01-01T10:00:00Z", "6:2004-01-01", "7:2004-02-02"})
+
+	aliases := n.FindAll(func(n *yaml.Node) bool { return n.Kind == yaml.AliasNode })
+	c.Assert(aliases, HasLen, 1)
+	c.Assert(aliases[0].Value, Equals, "w")
+
+	missing := n.FindAll(func(n *yaml.Node) bool {
+		if n.Kind != yaml.MappingNode {
+			return false
+		}
+		for i := 0; i < len(n.Content); i += 2 {
+			if n.Content[i].Value == "name" {
+				return false
+			}
+		}
+		return true
+	})
+	c.Assert(missing, HasLen, 3)
+	c.Assert(missing[1].Line, Equals, 5)
+
+	c.Assert(n.FindAll(func(*yaml.Node) bool { return false }), IsNil)
+}
+
+func (s *S) TestNodeScalarStyleAndTag(c *C) {
+	tests := []struct {
+		tag   string
+		style yaml.Style
+		value string
+		want  string
+		back  interface{}
+	}{
+		{"!!str", 0, "123", "\"123\"\n", "123"},
+		{"!!str", yaml.SingleQuotedStyle, "123", "'123'\n", "123"},
+		{"!!str", yaml.LiteralStyle, "123", "|-\n    123\n", "123"},
+		{"!!str", 0, "abc", "abc\n", "abc"},
+		{"!!int", 0, "123", "123\n", 123},
+		{"!!int", yaml.SingleQuotedStyle, "123", "!!int '123'\n", 123},
+		{"!!int", yaml.DoubleQuotedStyle, "123", "!!int \"123\"\n", 123},
+		{"!!bool", yaml.SingleQuotedStyle, "true", "!!bool 'true'\n", true},
+		{"!!null", yaml.SingleQuotedStyle, "", "!!null ''\n", nil},
+		{"", yaml.SingleQuotedStyle, "123", "'123'\n", "123"},
+		{"", 0, "123", "123\n", 123},
+	}
+	for _, t := range tests {
+		n := &yaml.Node{Kind: yaml.ScalarNode, Tag: t.tag, Style: t.style, Value: t.value}
+		out, err := yaml.Marshal(n)
+		c.Assert(err, IsNil)
+		c.Assert(string(out), Equals, t.want, Commentf("tag %q, style %d", t.tag, t.style))
+		var v interface{}
+		c.Assert(yaml.Unmarshal(out, &v), IsNil)
+		c.Assert(v, Equals, t.back, Commentf("tag %q, style %d", t.tag, t.style))
+	}
+}
+
+func (s *S) TestNodeResolvedValue(c *C) {
+	data := "int: 42\nbool: true\nstr: abc\nquoted: '42'\nfloat: 1.5\n" +
+		"null: ~\nhex: 0x1F\ntime: 2001-12-14\nalias: &a 7\nref: *a\nbad: !!int abc\nseq: [1]\n"
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(data), &n), IsNil)
+	m := n.Content[0]
+	values := make(map[string]interface{})
+	for i := 0; i < len(m.Content); i += 2 {
+		v, err := m.Content[i+1].ResolvedValue()
+		if err != nil {
+			v = err.Error()
+		}
+		values[m.Content[i].Value] = v
+	}
+	c.Assert(values, DeepEquals, map[string]interface{}{
+		"int":    42,
+		"bool":   true,
+		"str":    "abc",
+		"quoted": "42",
+		"float":  1.5,
+		"null":   nil,
+		"hex":    31,
+		"time":   time.Date(2001, 12, 14, 0, 0, 0, 0, time.UTC),
+		"alias":  7,
+		"ref":    7,
+		"bad":    "yaml: cannot decode !!str `abc` as a !!int",
+		"seq":    "yaml: ResolvedValue needs a scalar node",
+	})
+}
+
+func (s *S) TestNodeNullStyle(c *C) {
+	data := "tilde: ~\nword: null\nupper: NULL\nempty:\nquoted: !!null ''\ntagged: !!null nil\n" +
+		"string: 'null'\nzero: 0\nalias: &a ~\nref: *a\n"
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(data), &n), IsNil)
+	m := n.Content[0]
+	styles := make(map[string]yaml.NullStyle)
+	for i := 0; i < len(m.Content); i += 2 {
+		styles[m.Content[i].Value] = m.Content[i+1].NullStyle()
+	}
+	c.Assert(styles, DeepEquals, map[string]yaml.NullStyle{
+		"tilde":  yaml.TildeNull,
+		"word":   yaml.WordNull,
+		"upper":  yaml.WordNull,
+		"empty":  yaml.EmptyNull,
+		"quoted": yaml.EmptyNull,
+		"tagged": yaml.WordNull,
+		"string": yaml.NotNull,
+		"zero":   yaml.NotNull,
+		"alias":  yaml.TildeNull,
+		"ref":    yaml.TildeNull,
+	})
+	c.Assert((&yaml.Node{}).NullStyle(), Equals, yaml.EmptyNull)
+
+	// Both decode to nil pointers, while the nodes tell them apart.
+	var v struct {
+		Tilde *string
+		Word  *string
+	}
+	c.Assert(m.Decode(&v), IsNil)
+	c.Assert(v.Tilde, IsNil)
+	c.Assert(v.Word, IsNil)
+}
+
+func (s *S) TestNodeRender(c *C) {
+	data := "name: app\n" +
+		"server:\n" +
+		"    # Listening address.\n" +
+		"    host: localhost\n" +
+		"\n" +
+		"    ports: [80, 443]\n" +
+		"    tls:\n" +
+		"        enabled: true\n"
+	var n yaml.Node
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetPreserveBlankLines(true)
+	c.Assert(dec.Decode(&n), IsNil)
+	server := n.Content[0].Content[3]
+
+	out, err := server.Render()
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, "# Listening address.\nhost: localhost\nports: [80, 443]\ntls:\n    enabled: true\n")
+
+	out, err = server.Render(yaml.WithIndent(2), yaml.WithPreserveBlankLines(true))
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, "# Listening address.\nhost: localhost\n\nports: [80, 443]\ntls:\n  enabled: true\n")
+
+	var back yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(out), &back), IsNil)
+	c.Assert(back.Content[0].EqualValue(map[string]interface{}{
+		"host":  "localhost",
+		"ports": []interface{}{80, 443},
+		"tls":   map[string]interface{}{"enabled": true},
+	}), Equals, true)
+
+	out, err = server.Content[5].Content[1].Render()
+	c.Assert(err, IsNil)
+	c.Assert(out, Equals, "true\n")
+}
+
+func (s *S) TestTransform(c *C) {
+	data := "" +
+		"# First.\n" +
+		"name: app\n" +
+		"\n" +
+		"tags: [web, api]\n" +
+		"port: 80\n" +
+		"---\n" +
+		"name: db # Second.\n" +
+		"replicas: 3\n"
+	upper := func(n *yaml.Node) error {
+		for _, col := range n.FindAll(func(n *yaml.Node) bool {
+			return n.Kind == yaml.MappingNode || n.Kind == yaml.SequenceNode
+		}) {
+			for i, v := range col.Content {
+				if col.Kind == yaml.MappingNode && i%2 == 0 {
+					continue
+				}
+				if v.Kind == yaml.ScalarNode && v.ShortTag() == "!!str" {
+					v.Value = strings.ToUpper(v.Value)
+				}
+			}
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	err := yaml.Transform(strings.NewReader(data), &buf, upper, yaml.WithIndent(2), yaml.WithPreserveBlankLines(true))
+	c.Assert(err, IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		"# First.\n"+
+		"name: APP\n"+
+		"\n"+
+		"tags: [WEB, API]\n"+
+		"port: 80\n"+
+		"---\n"+
+		"name: DB # Second.\n"+
+		"replicas: 3\n")
+
+	buf.Reset()
+	c.Assert(yaml.Transform(strings.NewReader(data), &buf, upper), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		"# First.\n"+
+		"name: APP\n"+
+		"tags: [WEB, API]\n"+
+		"port: 80\n"+
+		"---\n"+
+		"name: DB # Second.\n"+
+		"replicas: 3\n")
+
+	buf.Reset()
+	calls := 0
+	err = yaml.Transform(strings.NewReader(data), &buf, func(n *yaml.Node) error {
+		if calls++; calls == 2 {
+			return fmt.Errorf("second document rejected")
+		}
+		return nil
+	})
+	c.Assert(err, ErrorMatches, "second document rejected")
+	c.Assert(buf.String(), Equals, "# First.\nname: app\ntags: [web, api]\nport: 80\n")
+
+	err = yaml.Transform(strings.NewReader("a: b\n---\na: [\n"), &buf, upper)
+	c.Assert(err, ErrorMatches, "yaml: line 3: .*")
+
+	err = yaml.Transform(strings.NewReader(data), errorWriter{}, upper)
+	c.Assert(err, ErrorMatches, "yaml: write error: some write error")
+}
+
+func (s *S) TestMarshalPatch(c *C) {
+	base := "" +
+		"name: app\n" +
+		"replicas: 1\n" +
+		"server:\n" +
+		"    host: localhost\n" +
+		"    port: 80\n" +
+		"debug: true\n" +
+		"tags: [web]\n"
+	target := "" +
+		"name: app\n" +
+		"replicas: 3\n" +
+		"server:\n" +
+		"    host: localhost\n" +
+		"    port: 80\n" +
+		"    tls: true\n" +
+		"tags: [web, api]\n" +
+		"owner: ops\n"
+	var baseNode, targetNode yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(base), &baseNode), IsNil)
+	c.Assert(yaml.Unmarshal([]byte(target), &targetNode), IsNil)
+
+	out, err := yaml.MarshalPatch(&baseNode, &targetNode)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, ""+
+		"replicas: 3\n"+
+		"server:\n"+
+		"    tls: true\n"+
+		"tags: [web, api]\n"+
+		"owner: ops\n"+
+		"debug: null\n")
+
+	var baseValue, patchValue, targetValue interface{}
+	c.Assert(yaml.Unmarshal([]byte(base), &baseValue), IsNil)
+	c.Assert(yaml.Unmarshal(out, &patchValue), IsNil)
+	c.Assert(yaml.Unmarshal([]byte(target), &targetValue), IsNil)
+	c.Assert(applyMergePatch(baseValue, patchValue), DeepEquals, targetValue)
+
+	out, err = yaml.MarshalPatch(&baseNode, &baseNode)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "{}\n")
+
+	c.Assert(yaml.Unmarshal([]byte("name: app\nserver: {}\nlimits: &l {cpu: 1}\nquota: *l\n"), &targetNode), IsNil)
+	out, err = yaml.MarshalPatch(&baseNode, &targetNode)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, ""+
+		"server: {host: null, port: null}\n"+
+		"limits: {cpu: 1}\n"+
+		"quota: {cpu: 1}\n"+
+		"replicas: null\n"+
+		"debug: null\n"+
+		"tags: null\n")
+
+	c.Assert(yaml.Unmarshal([]byte("name: app\nreplicas: ~\n"), &targetNode), IsNil)
+	_, err = yaml.MarshalPatch(&baseNode, &targetNode)
+	c.Assert(err, ErrorMatches, `yaml: cannot patch key "replicas" to null`)
+
+	// Values holding aliases to themselves can't be compared.
+	var recursive yaml.Node
+	c.Assert(yaml.Unmarshal([]byte("a: &x [1, *x]\n"), &recursive), IsNil)
+	_, err = yaml.MarshalPatch(&baseNode, &recursive)
+	c.Assert(err, ErrorMatches, "yaml: anchor 'x' value contains itself")
+	_, err = yaml.MarshalPatch(&recursive, &baseNode)
+	c.Assert(err, ErrorMatches, "yaml: anchor 'x' value contains itself")
+}
+
+func (s *S) TestNodeApplyPatch(c *C) {
+	base := "" +
+		"# Service settings.\n" +
+		"name: app\n" +
+		"replicas: 1 # Scaled by hand.\n" +
+		"defaults: &defaults\n" +
+		"    timeout: 30\n" +
+		"server:\n" +
+		"    # Bound locally.\n" +
+		"    host: localhost\n" +
+		"    port: 80\n" +
+		"client: *defaults\n" +
+		"debug: true\n"
+	patch := "" +
+		"replicas: 3\n" +
+		"server:\n" +
+		"    port: null\n" +
+		"    tls: {cert: a.pem}\n" +
+		"client:\n" +
+		"    retries: 2\n" +
+		"debug: null\n" +
+		"owner: ops\n"
+	var n, p yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(base), &n), IsNil)
+	c.Assert(yaml.Unmarshal([]byte(patch), &p), IsNil)
+	c.Assert(n.ApplyPatch(&p), IsNil)
+
+	out, err := yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, ""+
+		"# Service settings.\n"+
+		"name: app\n"+
+		"replicas: 3 # Scaled by hand.\n"+
+		"defaults: &defaults\n"+
+		"    timeout: 30\n"+
+		"server:\n"+
+		"    # Bound locally.\n"+
+		"    host: localhost\n"+
+		"    tls: {cert: a.pem}\n"+
+		"client:\n"+
+		"    timeout: 30\n"+
+		"    retries: 2\n"+
+		"owner: ops\n")
+
+	// Patches written by MarshalPatch turn the base into the target.
+	var target yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(base), &n), IsNil)
+	c.Assert(yaml.Unmarshal([]byte("name: web\nserver: {port: 8080}\nextra: [1, 2]\n"), &target), IsNil)
+	data, err := yaml.MarshalPatch(&n, &target)
+	c.Assert(err, IsNil)
+	c.Assert(yaml.Unmarshal(data, &p), IsNil)
+	c.Assert(n.ApplyPatch(&p), IsNil)
+	out, err = yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "# Service settings.\nname: web\nserver:\n    port: 8080\nextra: [1, 2]\n")
+
+	c.Assert(n.ApplyPatch(&yaml.Node{}), ErrorMatches, "yaml: cannot apply empty patch")
+
+	// Patches holding aliases to themselves fail before changing n.
+	c.Assert(yaml.Unmarshal([]byte("a: &x {b: *x}\n"), &p), IsNil)
+	c.Assert(n.ApplyPatch(&p), ErrorMatches, "yaml: anchor 'x' value contains itself")
+	out, err = yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "# Service settings.\nname: web\nserver:\n    port: 8080\nextra: [1, 2]\n")
+
+	// So do patches through aliases in n to values holding them.
+	c.Assert(yaml.Unmarshal([]byte("a: &x {b: *x}\nc: *x\n"), &n), IsNil)
+	c.Assert(yaml.Unmarshal([]byte("c: {d: 1}\n"), &p), IsNil)
+	c.Assert(n.ApplyPatch(&p), ErrorMatches, "yaml: anchor 'x' value contains itself")
+}
+
+// applyMergePatch merges patch onto v as described for yaml.MarshalPatch.
+func applyMergePatch(v, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		m = make(map[string]interface{})
+	}
+	for k, pv := range p {
+		if pv == nil {
+			delete(m, k)
+		} else {
+			m[k] = applyMergePatch(m[k], pv)
+		}
+	}
+	return m
+}
+
+func (s *S) TestNodeSetScalarValue(c *C) {
+	data := "" +
+		"# Server settings.\n" +
+		"host: localhost # Bound locally.\n" +
+		"\n" +
+		"# Listening port.\n" +
+		"port: 80 # Default.\n" +
+		"name: 'web'\n" +
+		"level: !!str 3\n"
+	var n yaml.Node
+	dec := yaml.NewDecoder(strings.NewReader(data))
+	dec.SetPreserveBlankLines(true)
+	c.Assert(dec.Decode(&n), IsNil)
+	m := n.Content[0]
+
+	m.Content[1].SetScalarValue("example.com")
+	m.Content[3].SetScalarValue("8080")
+	m.Content[5].SetScalarValue("8080")
+	m.Content[7].SetScalarValue("4")
+	c.Assert(m.Content[1].Tag, Equals, "!!str")
+	c.Assert(m.Content[3].Tag, Equals, "!!int")
+	c.Assert(m.Content[5].Tag, Equals, "!!str")
+	c.Assert(m.Content[7].Tag, Equals, "!!str")
+	c.Assert(m.Content[3].LineComment, Equals, "# Default.")
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	enc.SetPreserveBlankLines(true)
+	c.Assert(enc.Encode(&n), IsNil)
+	c.Assert(enc.Close(), IsNil)
+	c.Assert(buf.String(), Equals, ""+
+		"# Server settings.\n"+
+		"host: example.com # Bound locally.\n"+
+		"\n"+
+		"# Listening port.\n"+
+		"port: 8080 # Default.\n"+
+		"name: '8080'\n"+
+		"level: !!str 4\n")
+
+	var v map[string]interface{}
+	c.Assert(yaml.Unmarshal(buf.Bytes(), &v), IsNil)
+	c.Assert(v["port"], Equals, 8080)
+	c.Assert(v["name"], Equals, "8080")
+	c.Assert(v["level"], Equals, "4")
+
+	// Collections are replaced by the scalar.
+	list := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle, LineComment: "# Kept.", Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: "a"}}}
+	list.SetScalarValue("true")
+	c.Assert(*list, DeepEquals, yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true", LineComment: "# Kept."})
+}
+
+func (s *S) TestNodeDescribe(c *C) {
+	data := "" +
+		"base: &base {host: localhost, port: 80}\n" +
+		"server: *base\n" +
+		"tags: [web]\n" +
+		"ports: [80, 443]\n" +
+		"name: !!str 42\n" +
+		"note: " + strings.Repeat("long ", 10) + "\n"
+	var n yaml.Node
+	c.Assert(yaml.Unmarshal([]byte(data), &n), IsNil)
+	m := n.Content[0]
+	tests := []struct {
+		node *yaml.Node
+		want string
+	}{
+		{&n, "document(mapping(!!map, 6 keys))"},
+		{m.Content[1], "mapping(&base !!map, 2 keys)"},
+		{m.Content[1].Content[3], `scalar(!!int "80")`},
+		{m.Content[3], "alias(*base -> mapping(&base !!map, 2 keys))"},
+		{m.Content[5], "sequence(!!seq, 1 item)"},
+		{m.Content[7], "sequence(!!seq, 2 items)"},
+		{m.Content[9], `scalar(!!str "42")`},
+		{m.Content[11], `scalar(!!str "long long long long long long long lo...")`},
+		{&yaml.Node{Kind: yaml.DocumentNode}, "document(empty)"},
+		{&yaml.Node{Kind: yaml.AliasNode, Value: "missing"}, "alias(*missing)"},
+		{&yaml.Node{Kind: yaml.ScalarNode, Value: "a\nb"}, `scalar(!!str "a\nb")`},
+		{&yaml.Node{}, "unknown(kind 0)"},
+	}
+	for _, t := range tests {
+		c.Assert(t.node.Describe(), Equals, t.want)
+	}
+}
+
+func (s *S) TestNodeCollectionStyles(c *C) {
+	data := "a: [1, 2]\n" +
+		"b:\n" +
+		"    - 3\n" +
+		"    - {x: 1, y: [z]}\n" +
+		"c: {p: q}\n" +
+		"d:\n" +
+		"    e: []\n" +
+		"    f: {}\n"
+	var n yaml.Node
+	err := yaml.Unmarshal([]byte(data), &n)
+	c.Assert(err, IsNil)
+
+	m := n.Content[0]
+	c.Assert(m.Style&yaml.FlowStyle, Equals, yaml.Style(0))
+	c.Assert(m.Content[1].Style&yaml.FlowStyle, Equals, yaml.FlowStyle)
+	c.Assert(m.Content[3].Style&yaml.FlowStyle, Equals, yaml.Style(0))
+	c.Assert(m.Content[3].Content[1].Style&yaml.FlowStyle, Equals, yaml.FlowStyle)
+	c.Assert(m.Content[5].Style&yaml.FlowStyle, Equals, yaml.FlowStyle)
+
+	out, err := yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, data)
+
+	// The emitter follows the style set on each collection.
+	m.Content[1].Style = 0
+	m.Content[3].Style = yaml.FlowStyle
+	out, err = yaml.Marshal(&n)
+	c.Assert(err, IsNil)
+	c.Assert(string(out), Equals, "a:\n"+
+		"    - 1\n"+
+		"    - 2\n"+
+		"b: [3, {x: 1, y: [z]}]\n"+
+		"c: {p: q}\n"+
+		"d:\n"+
+		"    e: []\n"+
+		"    f: {}\n")
+}
+
 func fprintComments(out io.Writer, node *yaml.Node, indent string) {
 	switch node.Kind {
 	case yaml.ScalarNode:
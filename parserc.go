@@ -108,6 +108,12 @@ func yaml_parser_unfold_comments(parser *yaml_parser_t, token *yaml_token_t) {
 		if len(comment.foot) > 0 {
 			if len(parser.foot_comment) > 0 {
 				parser.foot_comment = append(parser.foot_comment, '\n')
+			} else if parser.preserve_blank_lines {
+				// Blank lines before a foot comment are kept as leading
+				// line breaks, as those after it are kept as trailing ones.
+				for i := 0; i < comment.blank_lines_before; i++ {
+					parser.foot_comment = append(parser.foot_comment, '\n')
+				}
 			}
 			parser.foot_comment = append(parser.foot_comment, comment.foot...)
 		}
@@ -466,6 +472,7 @@ func yaml_parser_set_event_comments(parser *yaml_parser_t, event *yaml_event_t)
 	}
 	// Always reset parser.blank_lines_before after transferring to event
 	parser.blank_lines_before = 0
+	parser.entry_blank_lines = 0
 	parser.head_comment = nil
 	parser.line_comment = nil
 	parser.foot_comment = nil
@@ -633,18 +640,17 @@ func yaml_parser_parse_node(parser *yaml_parser_t, event *yaml_event_t, block, i
 			implicit:        plain_implicit,
 			quoted_implicit: quoted_implicit,
 			style:           yaml_style_t(token.style),
+			block_indent:    token.block_indent,
 			blank_lines_before: token.blank_lines_before,
 			blank_lines_after:  0,
+			value_start_mark:   token.start_mark,
 		}
-		// Use parser's blank lines if they were set (e.g., from BLOCK_ENTRY_TOKEN)
-		// Don't consume them yet if we might have a head comment
-		if parser.blank_lines_before > 0 {
-			// fmt.Printf("DEBUG parser_parse_node: parser.blank_lines_before=%d for scalar %q\n",
-				// parser.blank_lines_before, string(token.value))
-			if event.blank_lines_before == 0 {
-				event.blank_lines_before = parser.blank_lines_before
-			}
-			// Don't reset parser.blank_lines_before yet - let yaml_parser_set_event_comments handle it
+		// Use the blank lines of the enclosing sequence entry, if any. The
+		// scanner-level parser.blank_lines_before can't be used here as it
+		// may already describe tokens scanned ahead of this one, such as
+		// the gap following an empty mapping value.
+		if parser.entry_blank_lines > 0 && event.blank_lines_before == 0 {
+			event.blank_lines_before = parser.entry_blank_lines
 		}
 		yaml_parser_set_event_comments(parser, event)
 		skip_token(parser)
@@ -719,6 +725,20 @@ func yaml_parser_parse_node(parser *yaml_parser_t, event *yaml_event_t, block, i
 			blank_lines_before: parser.blank_lines_before,
 			blank_lines_after:  parser.blank_lines_after,
 		}
+		if event.blank_lines_before > 0 {
+			// The blank lines belong to the mapping as a whole, such as a
+			// sequence item, rather than to its first key.
+			for i := parser.tokens_head + 1; i < len(parser.tokens); i++ {
+				if parser.tokens[i].typ != yaml_KEY_TOKEN {
+					if parser.tokens[i].typ == yaml_SCALAR_TOKEN {
+						parser.tokens[i].blank_lines_before = 0
+					}
+					break
+				}
+			}
+			parser.blank_lines_before = 0
+			parser.entry_blank_lines = 0
+		}
 		if parser.stem_comment != nil {
 			event.head_comment = parser.stem_comment
 			parser.stem_comment = nil
@@ -740,6 +760,7 @@ func yaml_parser_parse_node(parser *yaml_parser_t, event *yaml_event_t, block, i
 			style:           yaml_style_t(yaml_PLAIN_SCALAR_STYLE),
 			blank_lines_before: 0,
 			blank_lines_after:  0,
+			value_start_mark:   end_mark,
 		}
 		return true
 	}
@@ -785,9 +806,7 @@ func yaml_parser_parse_block_sequence_entry(parser *yaml_parser_t, event *yaml_e
 		// Transfer blank lines to parser for the next node
 		// Always set it, even if 0, to ensure clean state
 		parser.blank_lines_before = blank_lines
-		if blank_lines > 0 {
-			// fmt.Printf("DEBUG parser[1]: BLOCK_ENTRY transferred blank_lines=%d\n", blank_lines)
-		}
+		parser.entry_blank_lines = blank_lines
 		yaml_parser_split_stem_comment(parser, prior_head_len)
 		// Save blank lines before peeking (which might reset them)
 		saved_blank_lines := parser.blank_lines_before
@@ -847,8 +866,8 @@ func yaml_parser_parse_indentless_sequence_entry(parser *yaml_parser_t, event *y
 		skip_token(parser)
 		// Transfer blank lines to parser for the next node
 		if blank_lines > 0 {
-			// fmt.Printf("DEBUG parser: BLOCK_ENTRY (indentless) transferring blank_lines=%d to parser\n", blank_lines)
 			parser.blank_lines_before = blank_lines
+			parser.entry_blank_lines = blank_lines
 		}
 		yaml_parser_split_stem_comment(parser, prior_head_len)
 		// Save blank lines before peeking (which might reset them)
@@ -0,0 +1,200 @@
+package yaml
+
+import (
+	"fmt"
+)
+
+// MarshalPatch returns a YAML document holding the changes from base to
+// target as a merge patch, in the manner of JSON merge patches: mappings
+// hold only the keys added or changed in target, with removed keys set to
+// null, and any other value replaces the one in base as a whole. Merging
+// the patch onto base then yields target. Documents are patched through
+// their content, and aliases are followed, so that the patch holds the
+// values they refer to. As nulls stand for removals, an error is returned
+// if a key is added or changed to null in target, as well as for aliases
+// to values holding them.
+func MarshalPatch(base, target *Node) (out []byte, err error) {
+	defer handleErr(&err)
+	patch := mergePatch(detachedNode(documentContent(base)), detachedNode(documentContent(target)), "")
+	if patch == nil {
+		patch = &Node{Kind: MappingNode, Tag: mapTag}
+	}
+	return MarshalNode(patch)
+}
+
+// ApplyPatch merges patch onto the tree rooted at n, as a merge patch in
+// the manner of JSON merge patches and as written by MarshalPatch: keys
+// set to null in patch mappings are removed, keys set to mappings are
+// patched in turn, and other values replace the ones in n as a whole.
+// The comments of the nodes replaced are kept, as are those of all the
+// nodes patched. Documents are patched through their content, and
+// aliases in n to values being patched are replaced by patched copies of
+// these, leaving the anchored values as they are. An error is returned
+// for aliases to values holding them, met in patch or in n.
+func (n *Node) ApplyPatch(patch *Node) (err error) {
+	defer handleErr(&err)
+	patch = documentContent(patch)
+	if patch == nil || patch.Kind == 0 || patch.Kind == DocumentNode {
+		failf("cannot apply empty patch")
+	}
+	if n.Kind == DocumentNode {
+		if len(n.Content) == 0 {
+			n.Content = append(n.Content, &Node{})
+		}
+		n = n.Content[0]
+	}
+	// The patch is detached up front, so that recursive aliases in it
+	// fail before n is changed, and its nodes may be spliced into n.
+	applyPatch(n, detachedNode(patch))
+	return nil
+}
+
+// applyPatch merges the detached patch onto n in place.
+func applyPatch(n, patch *Node) {
+	switch patch.Kind {
+	case MappingNode:
+	case ScalarNode, SequenceNode:
+		replaceNode(n, patch)
+		return
+	default:
+		failf("cannot apply patch with node of unknown kind %d", patch.Kind)
+	}
+	if n.Kind == AliasNode && n.Alias != nil {
+		replaceNode(n, detachedNode(n))
+	}
+	if n.Kind != MappingNode {
+		replaceNode(n, &Node{Kind: MappingNode, Tag: mapTag, Style: patch.Style})
+	}
+	for i := 0; i+1 < len(patch.Content); i += 2 {
+		k, v := patch.Content[i], patch.Content[i+1]
+		j := patchKey(n, k)
+		if v.ShortTag() == nullTag {
+			if j >= 0 {
+				n.Content = append(n.Content[:j], n.Content[j+2:]...)
+			}
+			continue
+		}
+		if j >= 0 {
+			applyPatch(n.Content[j+1], v)
+			continue
+		}
+		value := &Node{}
+		applyPatch(value, v)
+		n.Content = append(n.Content, k, value)
+	}
+}
+
+// replaceNode makes n hold the value of with, keeping the comments and
+// blank lines of n.
+func replaceNode(n, with *Node) {
+	with.HeadComment, with.LineComment, with.FootComment = n.HeadComment, n.LineComment, n.FootComment
+	with.BlankLinesBefore, with.BlankLinesAfter = n.BlankLinesBefore, n.BlankLinesAfter
+	with.Line, with.Column = n.Line, n.Column
+	*n = *with
+}
+
+// documentContent returns the content of n if it's a document, or n
+// itself otherwise.
+func documentContent(n *Node) *Node {
+	if n != nil && n.Kind == DocumentNode && len(n.Content) == 1 {
+		return n.Content[0]
+	}
+	return n
+}
+
+// detachedNode returns a copy of the tree rooted at n with aliases
+// replaced by copies of the nodes they refer to, and anchors dropped.
+// It fails if an alias refers to a node holding it, as its copy would
+// never end.
+func detachedNode(n *Node) *Node {
+	return detachNode(n, make(map[*Node]bool))
+}
+
+// detachNode copies n as detachedNode does. path holds the nodes being
+// copied on the way to n.
+func detachNode(n *Node, path map[*Node]bool) *Node {
+	if n == nil {
+		return nil
+	}
+	for n.Kind == AliasNode && n.Alias != nil {
+		if path[n.Alias] {
+			failf("anchor '%s' value contains itself", n.Value)
+		}
+		n = n.Alias
+	}
+	c := *n
+	c.Anchor = ""
+	c.Content = nil
+	path[n] = true
+	for _, child := range n.Content {
+		c.Content = append(c.Content, detachNode(child, path))
+	}
+	delete(path, n)
+	return &c
+}
+
+// mergePatch returns the merge patch turning base into target, or nil if
+// they're equal. The path of the values compared is used in errors.
+func mergePatch(base, target *Node, path string) *Node {
+	if target == nil {
+		target = &Node{Kind: ScalarNode, Tag: nullTag, Value: "null"}
+	}
+	if base != nil && nodesEqual(base, target, true) {
+		return nil
+	}
+	if target.Kind == MappingNode {
+		if base == nil || base.Kind != MappingNode {
+			// Mappings in patches are merged rather than replacing,
+			// so they're written as added to an empty mapping.
+			base = &Node{Kind: MappingNode, Tag: mapTag}
+		}
+		return mappingPatch(base, target, path)
+	}
+	if target.ShortTag() == nullTag {
+		failf("cannot patch %s to null", patchPath(path))
+	}
+	return target
+}
+
+// mappingPatch returns the merge patch turning the base mapping into the
+// target one, in the style of the latter.
+func mappingPatch(base, target *Node, path string) *Node {
+	patch := &Node{Kind: MappingNode, Tag: mapTag, Style: target.Style}
+	for i := 0; i+1 < len(target.Content); i += 2 {
+		k, v := target.Content[i], target.Content[i+1]
+		var old *Node
+		if j := patchKey(base, k); j >= 0 {
+			old = base.Content[j+1]
+		}
+		if change := mergePatch(old, v, path+"."+k.Value); change != nil {
+			patch.Content = append(patch.Content, k, change)
+		}
+	}
+	for i := 0; i+1 < len(base.Content); i += 2 {
+		k := base.Content[i]
+		if patchKey(target, k) < 0 {
+			patch.Content = append(patch.Content, k, &Node{Kind: ScalarNode, Tag: nullTag, Value: "null"})
+		}
+	}
+	return patch
+}
+
+// patchKey returns the index of the key in m equal to k, or -1 if there's
+// no such key.
+func patchKey(m, k *Node) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if nodesEqual(m.Content[i], k, true) {
+			return i
+		}
+	}
+	return -1
+}
+
+// patchPath returns path as reported in errors, where the empty path is
+// the document root.
+func patchPath(path string) string {
+	if path == "" {
+		return "document"
+	}
+	return fmt.Sprintf("key %q", path[1:])
+}
@@ -0,0 +1,272 @@
+package yaml
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// preservedSource holds the text a document was decoded from by
+// UnmarshalPreserving.
+type preservedSource struct {
+	data []byte
+	bom  int // Length of the byte order mark skipped by the reader.
+
+	// offsets maps the character indexes of marks to byte offsets in data.
+	offsets []int
+}
+
+func newPreservedSource(data []byte) *preservedSource {
+	s := &preservedSource{data: data}
+	if bytes.HasPrefix(data, []byte(bom_UTF8)) {
+		s.bom = len(bom_UTF8)
+	} else if bytes.HasPrefix(data, []byte(bom_UTF16LE)) || bytes.HasPrefix(data, []byte(bom_UTF16BE)) {
+		// Marks don't relate to the encoded text simply enough.
+		return nil
+	}
+	for i := s.bom; i < len(data); {
+		s.offsets = append(s.offsets, i)
+		_, size := utf8.DecodeRune(data[i:])
+		i += size
+	}
+	s.offsets = append(s.offsets, len(data))
+	return s
+}
+
+func (s *preservedSource) offset(mark yaml_mark_t) int {
+	if mark.index >= len(s.offsets) {
+		return len(s.data)
+	}
+	return s.offsets[mark.index]
+}
+
+// nodeSource records a node as it was decoded by UnmarshalPreserving,
+// so that the changes made to it since can be told apart.
+type nodeSource struct {
+	src *preservedSource
+
+	// start and end delimit the text of a scalar in src, including its
+	// properties. They're unset for other nodes.
+	start, end int
+
+	// orig is a copy of the node as decoded, with its own copy of Content.
+	orig Node
+
+	// flow tells whether the node is within a flow collection, and key
+	// whether it's a mapping key.
+	flow, key bool
+}
+
+// UnmarshalPreserving decodes the first document found within the in
+// byte slice into n, as Unmarshal does, and also records where its
+// scalars were found in the text. The document may then be changed
+// and written back with MarshalPreserving.
+func UnmarshalPreserving(in []byte, n *Node) (err error) {
+	defer handleErr(&err)
+	p := newParser(in)
+	defer p.destroy()
+	p.source = newPreservedSource(in)
+	doc := p.parse()
+	if doc == nil {
+		*n = Node{}
+		return nil
+	}
+	if p.source != nil {
+		recordSource(doc, p.source, false, false)
+	}
+	*n = *doc
+	return nil
+}
+
+// recordSource keeps a copy of every node in the tree rooted at n.
+func recordSource(n *Node, src *preservedSource, flow, key bool) {
+	if n.source == nil {
+		n.source = &nodeSource{src: src}
+	}
+	s := n.source
+	s.orig = *n
+	s.orig.Content = append([]*Node(nil), n.Content...)
+	s.flow, s.key = flow, key
+	if n.Kind == AliasNode {
+		return
+	}
+	flow = flow || n.Style&FlowStyle != 0
+	for i, c := range n.Content {
+		recordSource(c, src, flow, n.Kind == MappingNode && i%2 == 0)
+	}
+}
+
+// MarshalPreserving serializes the document n decoded by UnmarshalPreserving
+// back into YAML, keeping the text it was decoded from byte for byte except
+// for the scalars whose value, tag, style or anchor were changed since, and
+// which are written anew in place. Scalars may also be replaced by new
+// scalar nodes, in which case the comments around the old ones are kept.
+//
+// Any other change, such as adding or removing entries, changing comments
+// or collection styles, can't be applied to the text, and the document is
+// then serialized as by Marshal. The same happens with documents which
+// weren't decoded by UnmarshalPreserving.
+func MarshalPreserving(n *Node) (out []byte, err error) {
+	if n.Kind == DocumentNode && n.source != nil {
+		var edits []sourceEdit
+		if collectEdits(n, &edits) {
+			return n.source.src.apply(edits), nil
+		}
+	}
+	return Marshal(n)
+}
+
+// sourceEdit replaces the text between start and end by text.
+type sourceEdit struct {
+	start, end int
+	text       string
+}
+
+func (s *preservedSource) apply(edits []sourceEdit) []byte {
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	out := make([]byte, 0, len(s.data))
+	last := 0
+	for _, e := range edits {
+		out = append(out, s.data[last:e.start]...)
+		out = append(out, e.text...)
+		last = e.end
+	}
+	return append(out, s.data[last:]...)
+}
+
+// collectEdits appends to edits the changes needed to the source text for
+// the tree rooted at n, and returns whether all of them could be expressed.
+func collectEdits(n *Node, edits *[]sourceEdit) bool {
+	s := n.source
+	if s == nil {
+		return false
+	}
+	o := &s.orig
+	if n.Kind != o.Kind || n.HeadComment != o.HeadComment || n.LineComment != o.LineComment || n.FootComment != o.FootComment {
+		return false
+	}
+	if n.Kind == ScalarNode {
+		return scalarEdit(n, s, edits)
+	}
+	if n.Tag != o.Tag || n.Style != o.Style || n.Anchor != o.Anchor || n.Value != o.Value || n.Alias != o.Alias || len(n.Content) != len(o.Content) {
+		return false
+	}
+	for i, c := range n.Content {
+		if c == o.Content[i] {
+			if !collectEdits(c, edits) {
+				return false
+			}
+			continue
+		}
+		// A scalar replaced by a new one.
+		old := o.Content[i].source
+		if c.source != nil || c.Kind != ScalarNode || old == nil || old.orig.Kind != ScalarNode {
+			return false
+		}
+		if !scalarEdit(c, old, edits) {
+			return false
+		}
+	}
+	return true
+}
+
+// scalarEdit appends the edit writing the scalar n in place of the one
+// recorded in s, if it differs.
+func scalarEdit(n *Node, s *nodeSource, edits *[]sourceEdit) bool {
+	o := &s.orig
+	if n.Value == o.Value && n.Tag == o.Tag && n.Style == o.Style && n.Anchor == o.Anchor {
+		return true
+	}
+	text, ok := renderScalar(n, s)
+	if !ok {
+		return false
+	}
+	start, end := s.start, s.end
+	if o.Style&(LiteralStyle|FoldedStyle) != 0 {
+		// Block scalars extend up to the following token, over the
+		// line breaks and blank lines after their content.
+		for end > start && isSourceSpace(s.src.data[end-1]) {
+			end--
+		}
+	}
+	*edits = append(*edits, sourceEdit{start, end, text})
+	return true
+}
+
+func isSourceSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// renderScalar returns the text of the scalar n for the position of the
+// one recorded in s.
+func renderScalar(n *Node, s *nodeSource) (string, bool) {
+	c := &Node{Kind: ScalarNode, Tag: n.Tag, Value: n.Value, Style: n.Style, Anchor: n.Anchor}
+	text, ok := renderNode(c)
+	if ok && s.flow && c.Style&(SingleQuotedStyle|DoubleQuotedStyle|LiteralStyle|FoldedStyle) == 0 &&
+		strings.ContainsAny(text, ",[]{}") {
+		c.Style |= DoubleQuotedStyle
+		text, ok = renderNode(c)
+	}
+	if !ok {
+		return "", false
+	}
+	if strings.Contains(text, "\n") {
+		if s.flow || s.key {
+			return "", false
+		}
+		indent := s.indent()
+		header := text[:strings.Index(text, "\n")]
+		if f := strings.Fields(header); len(f) > 0 && strings.IndexAny(f[len(f)-1], "|>") == 0 {
+			// The content of block scalars is indented by two spaces already.
+			indent -= 2
+		}
+		if indent > 0 {
+			text = strings.Replace(text, "\n", "\n"+strings.Repeat(" ", indent), -1)
+		}
+	}
+	return text, true
+}
+
+// indent returns the indentation for the lines following the first one
+// of a scalar written in place of the one recorded in s, so that they
+// belong to it. That's the indentation of the content for block scalars,
+// and the column of the scalar otherwise, which is more than enough.
+func (s *nodeSource) indent() int {
+	indent := s.orig.Column - 1
+	if s.orig.Style&(LiteralStyle|FoldedStyle) != 0 {
+		text := s.src.data[s.start:s.end]
+		for _, line := range strings.Split(string(text), "\n")[1:] {
+			if content := strings.TrimLeft(line, " "); content != "" && content != "\r" {
+				indent = len(line) - len(content)
+				break
+			}
+		}
+	}
+	return indent
+}
+
+// renderNode returns the text of n as a document of its own, without
+// its final line break.
+func renderNode(n *Node) (string, bool) {
+	e := newEncoder()
+	defer e.destroy()
+	e.indent = 2
+	e.preserveBlankLines = false
+	var err error
+	func() {
+		defer handleErr(&err)
+		e.marshalDoc("", reflect.ValueOf(n))
+		e.finish()
+	}()
+	if err != nil {
+		return "", false
+	}
+	text := strings.TrimSuffix(string(e.out), "\n")
+	if strings.HasSuffix(text, "\n...") || strings.HasSuffix(text, "\n") {
+		// Trailing line breaks are kept, which the text can't account for.
+		return "", false
+	}
+	return text, true
+}
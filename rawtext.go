@@ -0,0 +1,53 @@
+package yaml
+
+import (
+	"bytes"
+	"io"
+	"unicode/utf8"
+)
+
+// rawRecorder keeps the text read from r, so that the source text of
+// scalars may be recorded when decoding with Decoder.SetRecordRawText.
+type rawRecorder struct {
+	r    io.Reader
+	data []byte
+
+	// offsets maps the character indexes of marks to byte offsets in
+	// data, for the first scanned bytes of it.
+	offsets []int
+	scanned int
+	skip    bool // The text isn't UTF-8 encoded, so it can't be mapped.
+}
+
+func (r *rawRecorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.data = append(r.data, p[:n]...)
+	return n, err
+}
+
+// text returns the source text between the start and end marks.
+func (r *rawRecorder) text(start, end yaml_mark_t) string {
+	if len(r.offsets) == 0 && r.scanned == 0 {
+		if bytes.HasPrefix(r.data, []byte(bom_UTF8)) {
+			r.scanned = len(bom_UTF8)
+		} else if bytes.HasPrefix(r.data, []byte(bom_UTF16LE)) || bytes.HasPrefix(r.data, []byte(bom_UTF16BE)) {
+			r.skip = true
+		}
+	}
+	if r.skip {
+		return ""
+	}
+	return string(r.data[r.offset(start.index):r.offset(end.index)])
+}
+
+func (r *rawRecorder) offset(index int) int {
+	for len(r.offsets) <= index && r.scanned < len(r.data) {
+		r.offsets = append(r.offsets, r.scanned)
+		_, size := utf8.DecodeRune(r.data[r.scanned:])
+		r.scanned += size
+	}
+	if index < len(r.offsets) {
+		return r.offsets[index]
+	}
+	return len(r.data)
+}
@@ -17,7 +17,10 @@ package yaml
 
 import (
 	"encoding/base64"
+	"fmt"
 	"math"
+	"math/big"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -76,6 +79,7 @@ const (
 	timestampTag = "!!timestamp"
 	seqTag       = "!!seq"
 	mapTag       = "!!map"
+	setTag       = "!!set"
 	binaryTag    = "!!binary"
 	mergeTag     = "!!merge"
 )
@@ -84,7 +88,7 @@ var longTags = make(map[string]string)
 var shortTags = make(map[string]string)
 
 func init() {
-	for _, stag := range []string{nullTag, boolTag, strTag, intTag, floatTag, timestampTag, seqTag, mapTag, binaryTag, mergeTag} {
+	for _, stag := range []string{nullTag, boolTag, strTag, intTag, floatTag, timestampTag, seqTag, mapTag, setTag, binaryTag, mergeTag} {
 		ltag := longTag(stag)
 		longTags[stag] = ltag
 		shortTags[ltag] = stag
@@ -297,7 +301,7 @@ var allowedTimestampFormats = []string{
 	"2006-1-2 15:4:5.999999999",       // space separated with no time zone
 	"2006-1-2",                        // date only
 	// Notable exception: time.Parse cannot handle: "2001-12-14 21:59:43.10 -5"
-	// from the set of examples.
+	// from the set of examples, which parseZonedTimestamp takes care of.
 }
 
 // parseTimestamp parses s as a timestamp string and
@@ -322,5 +326,106 @@ func parseTimestamp(s string) (time.Time, bool) {
 			return t, true
 		}
 	}
-	return time.Time{}, false
+	return parseZonedTimestamp(s)
+}
+
+// zonedTimestampRE matches the timestamps with a time zone which
+// allowedTimestampFormats can't handle, as when the zone is separated
+// from the time by spaces or its hours have a single digit.
+var zonedTimestampRE = regexp.MustCompile(`^([0-9]{4}-[0-9]{1,2}-[0-9]{1,2})(?:[Tt]|[ \t]+)([0-9]{1,2}):([0-9]{2}:[0-9]{2}(?:\.[0-9]*)?)[ \t]*(?:Z|([-+])([0-9]{1,2})(?::([0-9]{2}))?)$`)
+
+// parseZonedTimestamp parses s as a timestamp with a time zone, as
+// in "2001-12-14 21:59:43.10 -5", keeping the offset of that zone.
+func parseZonedTimestamp(s string) (time.Time, bool) {
+	m := zonedTimestampRE.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}, false
+	}
+	date, err := time.Parse("2006-1-2", m[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	zone := "Z"
+	if m[4] != "" {
+		minutes := m[6]
+		if minutes == "" {
+			minutes = "00"
+		}
+		zone = m[4] + fmt.Sprintf("%02s", m[5]) + ":" + minutes
+	}
+	return parseTime(date.Format("2006-01-02") + "T" + fmt.Sprintf("%02s", m[2]) + ":" + m[3] + zone)
+}
+
+func parseTime(s string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	return t, err == nil
+}
+
+// byteSizeUnits holds the suffixes accepted for sizes in bytes, largest
+// first within each of the IEC and SI families.
+var byteSizeUnits = []struct {
+	suffix string
+	factor uint64
+}{
+	{"Ei", 1 << 60}, {"Pi", 1 << 50}, {"Ti", 1 << 40}, {"Gi", 1 << 30}, {"Mi", 1 << 20}, {"Ki", 1 << 10},
+	{"E", 1e18}, {"P", 1e15}, {"T", 1e12}, {"G", 1e9}, {"M", 1e6}, {"k", 1e3},
+}
+
+// isByteSizeType returns whether t can hold a size in bytes.
+func isByteSizeType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return t != durationType
+	}
+	return false
+}
+
+// parseByteSize parses s as a number of bytes, optionally followed by an
+// IEC or SI suffix such as "256Mi" or "1.5G". The size must amount to a
+// whole number of bytes.
+func parseByteSize(s string) (*big.Int, bool) {
+	number := s
+	factor := uint64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			number = s[:len(s)-len(unit.suffix)]
+			factor = unit.factor
+			break
+		}
+	}
+	if number == "" {
+		return nil, false
+	}
+	r, ok := new(big.Rat).SetString(strings.Replace(number, "_", "", -1))
+	if !ok {
+		return nil, false
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).SetUint64(factor)))
+	if !r.IsInt() {
+		return nil, false
+	}
+	return r.Num(), true
+}
+
+// formatByteSize formats size using the largest suffix which divides it
+// exactly, so that parseByteSize gets the same value back.
+func formatByteSize(size *big.Int) string {
+	if size.Sign() != 0 {
+		var best string
+		var bestFactor uint64
+		for _, unit := range byteSizeUnits {
+			f := new(big.Int).SetUint64(unit.factor)
+			if unit.factor > bestFactor && new(big.Int).Rem(size, f).Sign() == 0 {
+				best, bestFactor = unit.suffix, unit.factor
+			}
+		}
+		if bestFactor > 0 {
+			return new(big.Int).Quo(size, new(big.Int).SetUint64(bestFactor)).String() + best
+		}
+	}
+	return size.String()
 }
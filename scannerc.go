@@ -885,6 +885,13 @@ func yaml_parser_fetch_next_token(parser *yaml_parser_t) (ok bool) {
 		return yaml_parser_fetch_plain_scalar(parser)
 	}
 
+	// Tabs are only left here when used for indentation.
+	if is_tab(parser.buffer, parser.buffer_pos) {
+		return yaml_parser_set_scanner_error(parser,
+			"while scanning for the next token", parser.mark,
+			"found a tab character used for indentation")
+	}
+
 	// If we don't determine the token type so far, it is an error.
 	return yaml_parser_set_scanner_error(parser,
 		"while scanning for the next token", parser.mark,
@@ -2425,6 +2432,7 @@ func yaml_parser_scan_block_scalar(parser *yaml_parser_t, token *yaml_token_t, l
 		value:      s,
 		style:      yaml_LITERAL_SCALAR_STYLE,
 		blank_lines_before: parser.blank_lines_before,
+		block_indent:       increment,
 	}
 	if !literal {
 		token.style = yaml_FOLDED_SCALAR_STYLE
@@ -2552,6 +2560,7 @@ func yaml_parser_scan_flow_scalar(parser *yaml_parser_t, token *yaml_token_t, si
 				code_length := 0
 
 				// Check the escape character.
+				unknown := false
 				switch parser.buffer[parser.buffer_pos+1] {
 				case '0':
 					s = append(s, 0)
@@ -2600,13 +2609,21 @@ func yaml_parser_scan_flow_scalar(parser *yaml_parser_t, token *yaml_token_t, si
 				case 'U':
 					code_length = 8
 				default:
-					yaml_parser_set_scanner_error(parser, "while parsing a quoted scalar",
-						start_mark, "found unknown escape character")
-					return false
+					if !parser.lenient_escapes {
+						yaml_parser_set_scanner_error(parser, "while parsing a quoted scalar",
+							start_mark, "found unknown escape character")
+						return false
+					}
+					// Keep the backslash, and leave the character
+					// following it to be read as any other.
+					s = append(s, '\\')
+					unknown = true
 				}
 
 				skip(parser)
-				skip(parser)
+				if !unknown {
+					skip(parser)
+				}
 
 				// Consume an arbitrary escape code.
 				if code_length > 0 {
@@ -2779,11 +2796,12 @@ func yaml_parser_scan_plain_scalar(parser *yaml_parser_t, token *yaml_token_t) b
 		// Consume non-blank characters.
 		for !is_blankz(parser.buffer, parser.buffer_pos) {
 
-			// Check for indicators that may end a plain scalar.
+			// Check for indicators that may end a plain scalar. Within
+			// a scalar, "?" is a plain character even in flow context,
+			// as on lines continuing a scalar broken across lines.
 			if (parser.buffer[parser.buffer_pos] == ':' && is_blankz(parser.buffer, parser.buffer_pos+1)) ||
 				(parser.flow_level > 0 &&
-					(parser.buffer[parser.buffer_pos] == ',' ||
-						parser.buffer[parser.buffer_pos] == '?' || parser.buffer[parser.buffer_pos] == '[' ||
+					(parser.buffer[parser.buffer_pos] == ',' || parser.buffer[parser.buffer_pos] == '[' ||
 						parser.buffer[parser.buffer_pos] == ']' || parser.buffer[parser.buffer_pos] == '{' ||
 						parser.buffer[parser.buffer_pos] == '}')) {
 				break
@@ -2837,7 +2855,7 @@ func yaml_parser_scan_plain_scalar(parser *yaml_parser_t, token *yaml_token_t) b
 				// Check for tab characters that abuse indentation.
 				if leading_blanks && parser.mark.column < indent && is_tab(parser.buffer, parser.buffer_pos) {
 					yaml_parser_set_scanner_error(parser, "while scanning a plain scalar",
-						start_mark, "found a tab character that violates indentation")
+						parser.mark, "found a tab character used for indentation")
 					return false
 				}
 
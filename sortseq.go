@@ -0,0 +1,32 @@
+package yaml
+
+import "sort"
+
+// SortSequence reorders the items of the sequence n by the node found at
+// keyPath within each of them, comparing these with less, or by their
+// value when less is nil. Paths are as described for GetString, such as
+// "metadata.name" or "ports[0]", with the empty path standing for the items
+// themselves. Items without a node at that path are moved to the end, and
+// items comparing equal keep their relative order.
+//
+// Comments and blank lines are kept with the items they're attached to.
+// SortSequence does nothing if n isn't a sequence.
+func (n *Node) SortSequence(keyPath string, less func(a, b *Node) bool) {
+	if n.Kind != SequenceNode {
+		return
+	}
+	if less == nil {
+		less = func(a, b *Node) bool { return a.Value < b.Value }
+	}
+	keys := make(map[*Node]*Node, len(n.Content))
+	for _, item := range n.Content {
+		keys[item], _ = lookupNode(item, keyPath)
+	}
+	sort.SliceStable(n.Content, func(i, j int) bool {
+		a, b := keys[n.Content[i]], keys[n.Content[j]]
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return less(a, b)
+	})
+}
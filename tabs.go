@@ -0,0 +1,261 @@
+package yaml
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// defaultTabWidth is the number of spaces replacing each leading tab when
+// tabs are allowed, unless changed with Decoder.SetTabWidth.
+const defaultTabWidth = 2
+
+// tabExpander reads from r replacing the tabs used for indentation by
+// spaces, as set out for tabIndenter. All other bytes are passed through
+// unchanged.
+type tabExpander struct {
+	tabIndenter
+	r    io.Reader
+	in   [512]byte
+	line []byte // The part of a line read so far.
+	out  []byte
+	pos  int
+	err  error
+}
+
+func (t *tabExpander) Read(p []byte) (int, error) {
+	for t.pos == len(t.out) {
+		t.out, t.pos = t.out[:0], 0
+		if t.err != nil {
+			if len(t.line) == 0 {
+				return 0, t.err
+			}
+			t.out = t.indent(t.out, t.line)
+			t.line = t.line[:0]
+			continue
+		}
+		var n int
+		n, t.err = t.r.Read(t.in[:])
+		for _, c := range t.in[:n] {
+			t.line = append(t.line, c)
+			if c == '\n' || c == '\r' {
+				t.out = t.indent(t.out, t.line)
+				t.line = t.line[:0]
+			}
+		}
+	}
+	n := copy(p, t.out[t.pos:])
+	t.pos += n
+	return n, nil
+}
+
+// tabIndenter replaces every tab used for indentation in the lines given
+// to it in turn by width spaces. Tabs past the indentation of a line are
+// left alone, and so are those deeper than the indentation of a block
+// scalar, as they are part of its value.
+type tabIndenter struct {
+	width       int
+	block       bool // Within the lines of a block scalar.
+	parent      int  // Indentation of the line introducing the block scalar.
+	blockIndent int  // Indentation of the block scalar, or 0 if not yet known.
+}
+
+// indent appends line, ending with its line break if any, to out with
+// the tabs of its indentation replaced.
+func (t *tabIndenter) indent(out, line []byte) []byte {
+	ws := 0
+	for ws < len(line) && (line[ws] == ' ' || line[ws] == '\t') {
+		ws++
+	}
+	blank := ws == len(line) || line[ws] == '\n' || line[ws] == '\r'
+	if t.block && !blank && t.blockIndent == 0 {
+		// The leading spaces of the first line are indentation even
+		// after a tab, as when parsing, but tabs after them aren't.
+		n := 0
+		for n < ws && line[n] == '\t' {
+			n++
+		}
+		for n < ws && line[n] == ' ' {
+			n++
+		}
+		if width := indentWidth(line[:n], t.width); width > t.parent {
+			t.blockIndent = width
+		} else {
+			t.block = false
+		}
+	} else if t.block && !blank && indentWidth(line[:ws], t.width) <= t.parent {
+		t.block = false
+	}
+
+	if t.block {
+		// Only convert the indentation of the block scalar itself.
+		col, i := 0, 0
+		for ; i < ws && (t.blockIndent == 0 || col < t.blockIndent); i++ {
+			if line[i] == '\t' {
+				for j := 0; j < t.width; j++ {
+					out = append(out, ' ')
+				}
+				col += t.width
+			} else {
+				out = append(out, ' ')
+				col++
+			}
+		}
+		return append(out, line[i:]...)
+	}
+
+	for _, c := range line[:ws] {
+		if c == '\t' {
+			for j := 0; j < t.width; j++ {
+				out = append(out, ' ')
+			}
+		} else {
+			out = append(out, c)
+		}
+	}
+	out = append(out, line[ws:]...)
+	if indicator, ok := blockScalarHeader(line[ws:]); ok {
+		t.block = true
+		t.parent = indentWidth(line[:ws], t.width)
+		t.blockIndent = 0
+		if indicator > 0 {
+			t.blockIndent = t.parent + indicator
+		}
+	}
+	return out
+}
+
+// NormalizeIndentation returns a copy of src in which every tab used for
+// indentation is replaced by spacesPerTab spaces, which helps with tab
+// indented content pasted from elsewhere, since YAML forbids it. Tabs
+// past the indentation of a line are left alone, and so are those deeper
+// than the indentation of a block scalar, as they are part of its value.
+// This is the same as done by Decoder.SetAllowTabs. An error is returned
+// if the result still isn't valid YAML.
+func NormalizeIndentation(src []byte, spacesPerTab int) ([]byte, error) {
+	if spacesPerTab < 1 {
+		return nil, errors.New("yaml: tab width must be at least one space")
+	}
+	out := make([]byte, 0, len(src))
+	t := tabIndenter{width: spacesPerTab}
+	for len(src) > 0 {
+		line := src
+		if i := bytes.IndexAny(src, "\r\n"); i >= 0 {
+			line = src[:i+1]
+		}
+		src = src[len(line):]
+		out = t.indent(out, line)
+	}
+	if err := Valid(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DetectIndent returns the number of spaces by which the first block
+// nested under a mapping key is indented in src, so that tools editing it
+// may match its style. Comments, blank lines and the contents of block
+// scalars are skipped, and so are sequences written at the indentation of
+// their key, as they don't tell the width. It reports false when src holds
+// no block to infer the width from.
+func DetectIndent(src []byte) (int, bool) {
+	opener := -1 // Column of the key opening a block on the previous line.
+	header := -1 // Indentation of the header of a block scalar being skipped.
+	for len(src) > 0 {
+		line := src
+		if i := bytes.IndexByte(src, '\n'); i >= 0 {
+			line = src[:i+1]
+		}
+		src = src[len(line):]
+
+		ws := 0
+		for ws < len(line) && line[ws] == ' ' {
+			ws++
+		}
+		content := bytes.TrimRight(line[ws:], " \t\r\n")
+		if len(content) == 0 || content[0] == '#' {
+			continue
+		}
+		if header >= 0 {
+			if ws > header {
+				continue
+			}
+			header = -1
+		}
+		if opener >= 0 {
+			if ws > opener {
+				return ws - opener, true
+			}
+			opener = -1
+		}
+		if _, ok := blockScalarHeader(content); ok {
+			header = ws
+			continue
+		}
+		if i := bytes.Index(content, []byte(" #")); i >= 0 {
+			content = bytes.TrimRight(content[:i], " \t")
+		}
+		if bytes.HasSuffix(content, []byte{':'}) {
+			// Keys of compact sequence items start past their dashes.
+			col := ws
+			for bytes.HasPrefix(content, []byte("- ")) {
+				n := len(content)
+				content = bytes.TrimLeft(content[2:], " ")
+				col += n - len(content)
+			}
+			opener = col
+		}
+	}
+	return 0, false
+}
+
+// indentWidth returns the number of columns taken by the whitespace ws
+// once its tabs are replaced by the given number of spaces.
+func indentWidth(ws []byte, spacesPerTab int) int {
+	width := 0
+	for _, c := range ws {
+		if c == '\t' {
+			width += spacesPerTab
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// blockScalarHeader reports whether the line content ends with the header
+// of a block scalar, whose value starts on the following line, and the
+// explicit indentation indicator of that header, if any.
+func blockScalarHeader(content []byte) (indicator int, ok bool) {
+	if i := bytes.Index(content, []byte(" #")); i >= 0 {
+		content = content[:i]
+	} else if len(content) > 0 && content[0] == '#' {
+		return 0, false
+	}
+	fields := bytes.Fields(content)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	last := fields[len(fields)-1]
+	if last[0] != '|' && last[0] != '>' {
+		return 0, false
+	}
+	for _, c := range last[1:] {
+		switch {
+		case c >= '1' && c <= '9':
+			indicator = int(c - '0')
+		case c != '+' && c != '-':
+			return 0, false
+		}
+	}
+	if len(fields) == 1 {
+		return indicator, true
+	}
+	prev := fields[len(fields)-2]
+	switch {
+	case prev[len(prev)-1] == ':', string(prev) == "-", string(prev) == "---",
+		prev[0] == '!', prev[0] == '&':
+		return indicator, true
+	}
+	return 0, false
+}
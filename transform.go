@@ -0,0 +1,39 @@
+package yaml
+
+import (
+	"io"
+)
+
+// Transform decodes each document of the stream read from r into a Node,
+// calls fn to modify it, and writes it to w, packaging the common pattern
+// of filters editing YAML in place. Comments are kept as the Node API
+// keeps them, and the options configure the Encoder writing to w, with
+// blank lines preserved from r when WithPreserveBlankLines is enabled.
+// It stops at the first error from decoding, fn, or encoding, after
+// writing the documents transformed before it.
+func Transform(r io.Reader, w io.Writer, fn func(*Node) error, opts ...Option) error {
+	enc := NewEncoder(w)
+	for _, opt := range opts {
+		opt(enc)
+	}
+	dec := NewDecoder(r)
+	dec.SetPreserveBlankLines(enc.preserveBlankLines)
+	for {
+		var n Node
+		if err := dec.Decode(&n); err == io.EOF {
+			break
+		} else if err != nil {
+			enc.Close()
+			return err
+		}
+		if err := fn(&n); err != nil {
+			enc.Close()
+			return err
+		}
+		if err := enc.Encode(&n); err != nil {
+			enc.Close()
+			return err
+		}
+	}
+	return enc.Close()
+}
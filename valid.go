@@ -0,0 +1,30 @@
+package yaml
+
+// Valid checks that src holds a well-formed YAML stream, returning the
+// first syntax error found, with its line as decoding reports it, or nil.
+// The stream is parsed to completion without building nodes or values,
+// which makes it a cheap gate before decoding. Aliases to anchors not
+// defined before them are reported too, as decoding fails on them.
+// Whether the documents fit a given type is left to decoding.
+func Valid(src []byte) (err error) {
+	defer handleErr(&err)
+	p := newParser(src)
+	defer p.destroy()
+	anchors := make(map[string]bool)
+	for {
+		switch p.peek() {
+		case yaml_STREAM_END_EVENT:
+			return nil
+		case yaml_SCALAR_EVENT, yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT:
+			if len(p.event.anchor) > 0 {
+				anchors[string(p.event.anchor)] = true
+			}
+		case yaml_ALIAS_EVENT:
+			if !anchors[string(p.event.anchor)] {
+				failf("line %d: unknown anchor '%s' referenced", p.event.start_mark.line+1, p.event.anchor)
+			}
+		}
+		yaml_event_delete(&p.event)
+		p.event.typ = yaml_NO_EVENT
+	}
+}
@@ -0,0 +1,205 @@
+package yaml
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// verifyDoc encodes in as marshalDoc does, and then fails unless the text
+// written for it decodes back to the same value, as set with
+// Encoder.SetVerify.
+func (e *encoder) verifyDoc(tag string, in reflect.Value) {
+	var out bytes.Buffer
+	w := e.emitter.output_writer
+	e.emitter.output_writer = io.MultiWriter(w, &out)
+	e.verify = false
+	defer func() {
+		e.emitter.output_writer = w
+		e.verify = true
+	}()
+	e.marshalDoc(tag, in)
+	if !in.IsValid() {
+		return
+	}
+
+	// Nodes are compared through the values they decode into.
+	want, got := in, reflect.New(in.Type())
+	switch n := in.Interface().(type) {
+	case *Node:
+		want, got = decodeNodeValue(n), reflect.New(ifaceType)
+	case Node:
+		want, got = decodeNodeValue(&n), reflect.New(ifaceType)
+	}
+	if err := unmarshal(out.Bytes(), got.Interface(), false); err != nil {
+		failf("encoded output doesn't decode back: %s", strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	if !semanticEqual(want, got.Elem()) {
+		failf("encoded output doesn't decode back to the value encoded")
+	}
+}
+
+// decodeNodeValue returns the value n decodes into when decoded into
+// an interface.
+func decodeNodeValue(n *Node) reflect.Value {
+	v := reflect.New(ifaceType)
+	if err := n.Decode(v.Interface()); err != nil {
+		failf("encoded node can't be decoded: %s", strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	return v.Elem()
+}
+
+// semanticEqual reports whether a and b hold the same data once encoded.
+// Unlike with reflect.DeepEqual, nil and empty collections are equal, and
+// so are numbers of different types with the same value, and NaNs.
+func semanticEqual(a, b reflect.Value) bool {
+	a, b = indirectValue(a), indirectValue(b)
+	if isNilValue(a) || isNilValue(b) {
+		return isEmptyValue(a) && isEmptyValue(b)
+	}
+	if a.Type() == nodeType {
+		n := a.Interface().(Node)
+		a = indirectValue(decodeNodeValue(&n))
+	}
+	if b.Type() == nodeType {
+		n := b.Interface().(Node)
+		b = indirectValue(decodeNodeValue(&n))
+	}
+	if equal, ok := numberEqual(a, b); ok {
+		return equal
+	}
+	switch a.Kind() {
+	case reflect.Slice, reflect.Array:
+		if b.Kind() != reflect.Slice && b.Kind() != reflect.Array || a.Len() != b.Len() {
+			return false
+		}
+		for i := 0; i < a.Len(); i++ {
+			if !semanticEqual(a.Index(i), b.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if b.Kind() != reflect.Map || a.Len() != b.Len() {
+			return false
+		}
+		for _, k := range a.MapKeys() {
+			v, ok := mapIndex(b, k)
+			if !ok || !semanticEqual(a.MapIndex(k), v) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		if a.Type() != b.Type() {
+			return false
+		}
+		if a.Type() == timeType {
+			return a.Interface().(time.Time).Equal(b.Interface().(time.Time))
+		}
+		compared := false
+		for i := 0; i < a.NumField(); i++ {
+			field := a.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			compared = true
+			if strings.Split(field.Tag.Get("yaml"), ",")[0] == "-" {
+				continue
+			}
+			if !semanticEqual(a.Field(i), b.Field(i)) {
+				return false
+			}
+		}
+		if compared {
+			return true
+		}
+	}
+	return a.Type() == b.Type() && reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// indirectValue returns the value v points to or holds, through any number
+// of non-nil pointers and interfaces.
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+func isNilValue(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	if isNilValue(v) {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	}
+	return false
+}
+
+// numberEqual reports whether a and b are numbers of the same value, and
+// whether they are numbers at all.
+func numberEqual(a, b reflect.Value) (equal, ok bool) {
+	as, aok := numberString(a)
+	bs, bok := numberString(b)
+	if !aok || !bok {
+		return false, aok || bok
+	}
+	if as == bs {
+		return true, true
+	}
+	af, aerr := strconv.ParseFloat(as, 64)
+	bf, berr := strconv.ParseFloat(bs, 64)
+	return aerr == nil && berr == nil && (af == bf || math.IsNaN(af) && math.IsNaN(bf)), true
+}
+
+// numberString returns the decimal text of the number held by v, with
+// integers written exactly, and whether v holds a number.
+func numberString(v reflect.Value) (string, bool) {
+	if v.Type() == durationType {
+		return "", false
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32), true
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), true
+	}
+	return "", false
+}
+
+// mapIndex returns the value of m for the key equal to k, looking for it
+// among the keys of m when their types differ.
+func mapIndex(m, k reflect.Value) (reflect.Value, bool) {
+	if k.Type().AssignableTo(m.Type().Key()) {
+		if v := m.MapIndex(k); v.IsValid() {
+			return v, true
+		}
+	}
+	for _, mk := range m.MapKeys() {
+		if semanticEqual(k, mk) {
+			return m.MapIndex(mk), true
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -28,6 +28,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"time"
 	"unicode/utf8"
 )
 
@@ -57,6 +58,18 @@ type Marshaler interface {
 	MarshalYAML() (interface{}, error)
 }
 
+// The Validator interface may be implemented by struct types to check
+// their values once they were unmarshaled from a mapping, with all of
+// their fields set. The path of the mapping within the document, made of
+// dotted keys and [i] sequence indexes as in "servers[1].tls", is provided
+// for context, and is empty for the top-level value.
+//
+// If an error is returned by ValidateYAML, the unmarshaling procedure
+// stops and returns a *ValidationError holding it.
+type Validator interface {
+	ValidateYAML(path string) error
+}
+
 // Unmarshal decodes the first document found within the in byte slice
 // and assigns decoded values into the out value.
 //
@@ -79,6 +92,12 @@ type Marshaler interface {
 // used to tweak the marshalling process (see Marshal).
 // Conflicting names result in a runtime error.
 //
+// Mapping keys which are sequences or mappings, as in "? [1, 2]", may be
+// unmarshalled into maps whose keys are arrays or structs of the same shape,
+// such as map[[2]int]string. As slices and maps can't be keys of Go maps,
+// unmarshalling such keys into interfaces fails with an "invalid map key"
+// error. Nodes hold them as they are.
+//
 // For example:
 //
 //     type T struct {
@@ -100,6 +119,42 @@ type Decoder struct {
 	parser             *parser
 	knownFields        bool
 	preserveBlankLines bool
+	keyNormalizer      func(string) string
+	defaulter          func(field reflect.StructField) (interface{}, bool)
+	includeResolver    func(path string) (*Node, error)
+	discriminatorKey   string
+	discriminator      func(disc string) interface{}
+	registeredTypes    map[string]reflect.Type
+	emptyDocAs         EmptyDocMode
+	recordRawText      bool
+	keepUnknownTags    bool
+	decodeHooks        []decodeHook
+	unwrapSingletonSeq bool
+	leadingZeroStrings bool
+	timeFormats        []string
+	warningHandler     func(Warning)
+	mergeWarnings      bool
+	lenientEscapes     bool
+	maxDocuments       int
+	documents          int
+	stats              DecodeStats
+	tabWidth           int
+	inSequence         bool
+}
+
+// DecodeStats holds figures about the work done to decode a document,
+// which help with choosing safe limits for untrusted input.
+type DecodeStats struct {
+	// Aliases is the number of aliases resolved.
+	Aliases int
+
+	// MaxDepth is the deepest nesting of nodes reached, with the
+	// top-level value of the document at depth 1.
+	MaxDepth int
+
+	// Nodes is the number of nodes decoded. Nodes reached through
+	// aliases are counted every time they are decoded.
+	Nodes int
 }
 
 // NewDecoder returns a new decoder that reads from r.
@@ -116,15 +171,356 @@ func NewDecoder(r io.Reader) *Decoder {
 	return dec
 }
 
+// Reset makes dec read from r as if it were a new Decoder with the same
+// settings, reusing the memory allocated so far, which saves allocations
+// when decoding many small documents. Any input left unread from the
+// previous reader is discarded.
+func (dec *Decoder) Reset(r io.Reader) {
+	p := dec.parser
+	in := p.parser.input_reader
+	if p.raw != nil {
+		in = p.raw.r
+	}
+	// Keep the readers set up by SetAllowTabs and SetLimitBytes.
+	var tabs *tabExpander
+	if t, ok := in.(*tabExpander); ok {
+		tabs, in = t, t.r
+	}
+	if l, ok := in.(*limitReader); ok {
+		*l = limitReader{r: r, limit: l.limit}
+		r = l
+	}
+	if tabs != nil {
+		*tabs = tabExpander{tabIndenter: tabIndenter{width: tabs.width}, r: r, out: tabs.out[:0]}
+		r = tabs
+	}
+	if p.event.typ != yaml_NO_EVENT {
+		yaml_event_delete(&p.event)
+	}
+	yaml_parser_reset(&p.parser)
+	yaml_parser_set_input_reader(&p.parser, r)
+	p.parser.preserve_blank_lines = p.preserveBlankLines
+	p.parser.lenient_escapes = dec.lenientEscapes
+	p.doc, p.anchors, p.doneInit, p.raw = nil, nil, false, nil
+	dec.stats, dec.inSequence, dec.documents = DecodeStats{}, false, 0
+}
+
 // KnownFields ensures that the keys in decoded mappings to
 // exist as fields in the struct being decoded into.
 func (dec *Decoder) KnownFields(enable bool) {
 	dec.knownFields = enable
 }
 
+// SetAllowTabs controls whether tabs are accepted for indentation, which
+// YAML forbids. When enabled, every tab within the leading whitespace of
+// a line is replaced by spaces before parsing, two of them unless changed
+// with SetTabWidth, as done by NormalizeIndentation. Tabs deeper than the
+// indentation of a block scalar are kept, as they are part of its value.
+// It must be called before the first call to Decode.
+func (dec *Decoder) SetAllowTabs(enable bool) {
+	r := dec.parser.parser.input_reader
+	if t, ok := r.(*tabExpander); ok {
+		if !enable {
+			dec.parser.parser.input_reader = t.r
+		}
+		return
+	}
+	if enable {
+		width := dec.tabWidth
+		if width == 0 {
+			width = defaultTabWidth
+		}
+		dec.parser.parser.input_reader = &tabExpander{tabIndenter: tabIndenter{width: width}, r: r}
+	}
+}
+
+// SetLenientEscapes controls whether escape sequences in double-quoted
+// scalars which YAML doesn't define, such as "\q", are kept as written,
+// backslash included, rather than failing to parse, for input written by
+// lenient producers. Escapes YAML defines are decoded as usual, and
+// malformed ones such as "\x" without two hexadecimal digits still fail.
+func (dec *Decoder) SetLenientEscapes(enable bool) {
+	dec.lenientEscapes = enable
+	dec.parser.parser.lenient_escapes = enable
+}
+
+// SetLimitBytes makes decoding fail once more than n bytes were read
+// from the input, which guards against oversized documents from untrusted
+// sources. A limit of zero or less removes it. It must be called before
+// the first call to Decode.
+func (dec *Decoder) SetLimitBytes(n int64) {
+	r := &dec.parser.parser.input_reader
+	if t, ok := (*r).(*tabExpander); ok {
+		r = &t.r
+	}
+	if l, ok := (*r).(*limitReader); ok {
+		*r = l.r
+	}
+	if n > 0 {
+		*r = &limitReader{r: *r, limit: n}
+	}
+}
+
+// SetMaxDocuments makes decoding fail on reaching the start of a document
+// past the first n of the stream, which guards against untrusted streams
+// holding many documents. Documents are counted as they're decoded, by
+// Decode and DecodeArrayElement alike, and the one over the limit isn't
+// read. A limit of zero or less removes it.
+func (dec *Decoder) SetMaxDocuments(n int) {
+	dec.maxDocuments = n
+}
+
+// countDocument counts the document starting with the next event, if
+// any, failing if it's past the limit set with SetMaxDocuments.
+func (dec *Decoder) countDocument() {
+	if dec.maxDocuments <= 0 {
+		return
+	}
+	p := dec.parser
+	p.init()
+	if p.peek() != yaml_DOCUMENT_START_EVENT {
+		return
+	}
+	if dec.documents >= dec.maxDocuments {
+		failf("line %d: stream holds more than the limit of %s", p.event.start_mark.line+1, plural(dec.maxDocuments, "document"))
+	}
+	dec.documents++
+}
+
+// SetTabWidth changes the number of spaces replacing each tab used for
+// indentation when tabs are allowed with SetAllowTabs.
+func (dec *Decoder) SetTabWidth(spaces int) {
+	if spaces < 1 {
+		panic("yaml: tab width must be at least one space")
+	}
+	dec.tabWidth = spaces
+	if t, ok := dec.parser.parser.input_reader.(*tabExpander); ok {
+		t.width = spaces
+	}
+}
+
+// SetKeyNormalizer sets a function applied to every string mapping key
+// before it is matched against struct fields or stored into a map, such
+// as strings.ToLower for case-insensitive documents. Keys which become
+// equal once normalized are reported as duplicates. A nil function
+// disables normalization.
+func (dec *Decoder) SetKeyNormalizer(fn func(string) string) {
+	dec.keyNormalizer = fn
+}
+
+// SetDefaulter sets a function providing the value of struct fields whose
+// key is missing from the decoded mapping, including keys brought in
+// through merges. It's called once such a mapping has been decoded, and
+// the value returned is stored into the field when ok is true, converted
+// to the field type if necessary. Fields of structs which aren't decoded
+// at all, because their whole mapping is missing, are left alone.
+// A nil function disables defaulting.
+func (dec *Decoder) SetDefaulter(fn func(field reflect.StructField) (value interface{}, ok bool)) {
+	dec.defaulter = fn
+}
+
+// AddDecodeHook adds a function converting scalar values before they're
+// stored, such as strings into net.IP or url.URL values. It's called with
+// the type of the value resolved from the scalar, such as string or int,
+// the type of the destination, and that value. When it returns true, the
+// value it returns is stored instead, converted to the destination type if
+// necessary, and an error it returns is reported at the line of the
+// scalar. Hooks are called in the order they were added until one of them
+// returns true. They're called for mapping keys as well, but never for
+// nulls.
+func (dec *Decoder) AddDecodeHook(fn func(from reflect.Type, to reflect.Type, data interface{}) (interface{}, bool, error)) {
+	dec.decodeHooks = append(dec.decodeHooks, fn)
+}
+
+// SetDiscriminator sets a function selecting the type of the values held
+// by mappings decoded into an interface, such as interface{} or one
+// implemented by plugin configurations, based on the string value of
+// their key field. The function returns a value of the type to use, such
+// as &HTTPConfig{}, and the other entries of the mapping are decoded into
+// a new value of that type which is then stored into the interface.
+// Mappings without the key, or for which the function returns nil, are
+// decoded as usual. A nil function disables the selection.
+func (dec *Decoder) SetDiscriminator(field string, fn func(disc string) interface{}) {
+	dec.discriminatorKey = field
+	dec.discriminator = fn
+}
+
+// RegisterType makes values tagged with tag, such as "!http", decode into
+// a new value of type t when decoded into an interface, such as interface{}
+// or one implemented by plugin configurations, which then holds it. The
+// tag itself is ignored when decoding into t, so "!port 80" may decode into
+// an integer type. Values of types which can't be held by the interface
+// are reported as type errors, and values decoded into other types aren't
+// affected.
+func (dec *Decoder) RegisterType(tag string, t reflect.Type) {
+	if dec.registeredTypes == nil {
+		dec.registeredTypes = make(map[string]reflect.Type)
+	}
+	dec.registeredTypes[shortTag(tag)] = t
+}
+
+// EmptyDocMode selects how documents without any content, such as "---"
+// alone, are decoded, as set with Decoder.SetEmptyDocAs.
+type EmptyDocMode int
+
+const (
+	// EmptyDocNil decodes empty documents as null values, which reset
+	// interfaces, pointers, maps and slices to nil and leave other values
+	// untouched. It's the default.
+	EmptyDocNil EmptyDocMode = iota
+
+	// EmptyDocZero resets the value decoded into to its zero value.
+	EmptyDocZero
+
+	// EmptyDocError reports empty documents with ErrEmptyDocument.
+	EmptyDocError
+)
+
+// ErrEmptyDocument is returned by Decoder.Decode for documents without
+// any content when the decoder was set to do so with SetEmptyDocAs.
+var ErrEmptyDocument = errors.New("yaml: empty document")
+
+// SetEmptyDocAs changes how documents without any content are decoded.
+// Inputs with no document left still make Decode return io.EOF, which
+// allows telling absent documents from empty ones.
+func (dec *Decoder) SetEmptyDocAs(mode EmptyDocMode) {
+	dec.emptyDocAs = mode
+}
+
+// isEmptyDocument returns whether the document n has no content.
+func isEmptyDocument(n *Node) bool {
+	if n.Kind != DocumentNode {
+		return false
+	}
+	if len(n.Content) == 0 {
+		return true
+	}
+	c := n.Content[0]
+	return c.Kind == ScalarNode && c.Value == "" && c.Style == 0 && c.Tag == nullTag && c.Anchor == ""
+}
+
+// SetIncludeResolver sets a function returning the node of the document
+// at the given path, such as one read from a file. When set, scalars
+// tagged as !include are replaced by the node returned for their value
+// before decoding, and includes found in that node are resolved as well.
+// Including a path from the document it's included in, directly or not,
+// is reported as an error. A nil function disables includes.
+func (dec *Decoder) SetIncludeResolver(fn func(path string) (*Node, error)) {
+	dec.includeResolver = fn
+}
+
+// SetRecordRawText controls whether the text of scalars in the decoded
+// YAML is recorded into the RawValue field of their nodes, such as "a\tb"
+// with its quotes and escape where Value holds a tab. The whole input read
+// is kept in memory while decoding when enabled. It must be called before
+// the first call to Decode.
+func (dec *Decoder) SetRecordRawText(enable bool) {
+	dec.recordRawText = enable
+}
+
+// SetKeepUnknownTags controls whether scalars with a tag the resolver
+// doesn't know, such as "!!unknown foo" or "!color red", are decoded into
+// interfaces as a TaggedValue holding both the tag and the text, rather
+// than as a plain string losing the tag. Decoding into other types isn't
+// affected.
+func (dec *Decoder) SetKeepUnknownTags(enable bool) {
+	dec.keepUnknownTags = enable
+}
+
+// SetUnwrapSingletonSeq controls whether sequences holding a single item,
+// as in "items: [x]", are decoded into values which aren't collections,
+// such as strings, numbers or structs, as that item, for producers which
+// wrap single values in lists. Sequences of other lengths still fail to
+// decode into them.
+func (dec *Decoder) SetUnwrapSingletonSeq(enable bool) {
+	dec.unwrapSingletonSeq = enable
+}
+
+// SetLeadingZeroStrings controls whether plain numbers written with a
+// leading zero before further digits, as in "zipcode: 07030", are decoded
+// as the strings they're written as, rather than as numbers. Otherwise
+// such integers are read as octal, following YAML 1.1. They then fail to
+// decode into numeric types like any other string. Numbers explicitly
+// tagged, as in "!!int 0755", aren't affected.
+func (dec *Decoder) SetLeadingZeroStrings(enable bool) {
+	dec.leadingZeroStrings = enable
+}
+
+// SetTimeFormats sets layouts, as accepted by time.Parse, which are tried
+// in order when decoding scalars into time.Time values, before the formats
+// of !!timestamp values. Quoted strings are then decoded with either, where
+// otherwise only the RFC 3339 format of time.Time.UnmarshalText is accepted
+// from them. Values tagged with other types than strings or timestamps
+// aren't affected. Calling it with no layouts restores the default.
+func (dec *Decoder) SetTimeFormats(layouts ...string) {
+	dec.timeFormats = append([]string(nil), layouts...)
+}
+
+// SetWarningHandler sets a function called for every lossy conversion
+// made while decoding, which doesn't otherwise fail. These are numbers
+// decoded into floating point values, interfaces included, with more
+// significant digits than the type can hold, and alias keys set with the
+// "alias" struct tag flag ignored as the primary key is also present.
+// Keys of merged mappings which are overridden may be reported as well,
+// as enabled with SetMergeWarnings.
+func (dec *Decoder) SetWarningHandler(fn func(Warning)) {
+	dec.warningHandler = fn
+}
+
+// SetMergeWarnings controls whether the keys of mappings merged with "<<"
+// which are ignored as they're set already are reported to the function
+// set with SetWarningHandler, to check which values are taken from where.
+// Keys of the mapping merging others take precedence over all merged ones,
+// and mappings listed earlier in "<<: [*a, *b]" take precedence over the
+// ones listed after them, with the mappings each merges coming after its
+// own keys.
+func (dec *Decoder) SetMergeWarnings(enable bool) {
+	dec.mergeWarnings = enable
+}
+
+// A Warning describes a lossy conversion made while decoding, as reported
+// to the function set with Decoder.SetWarningHandler.
+type Warning struct {
+	// Path locates the node in the document, in the form described by
+	// Validator.
+	Path string
+
+	// Line and Column are the position of the node in the source,
+	// starting at 1.
+	Line   int
+	Column int
+
+	// Message tells what was lost.
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Path == "" {
+		return fmt.Sprintf("line %d: %s", w.Line, w.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", w.Line, w.Path, w.Message)
+}
+
+// A TaggedValue holds a scalar with a tag unknown to the resolver, as
+// decoded into interfaces after Decoder.SetKeepUnknownTags. It's encoded
+// back as the same tagged scalar.
+type TaggedValue struct {
+	// Tag is the tag of the scalar in its short form, as in "!!unknown".
+	Tag string
+
+	// Value is the text of the scalar.
+	Value string
+}
+
+// MarshalYAML implements the Marshaler interface.
+func (v TaggedValue) MarshalYAML() (interface{}, error) {
+	return &Node{Kind: ScalarNode, Tag: v.Tag, Value: v.Value, Style: TaggedStyle}, nil
+}
+
 // SetPreserveBlankLines controls whether the decoder tracks blank lines
 // between elements for round-trip preservation. When enabled, the parser
-// populates BlankLinesBefore and BlankLinesAfter fields in Node structs.
+// populates BlankLinesBefore and BlankLinesAfter fields in Node structs,
+// and keeps blank lines before a FootComment as leading line breaks in it.
 func (dec *Decoder) SetPreserveBlankLines(enable bool) {
 	dec.preserveBlankLines = enable
 	if dec.parser != nil {
@@ -133,23 +529,45 @@ func (dec *Decoder) SetPreserveBlankLines(enable bool) {
 	}
 }
 
+// Stats returns figures about the last call to Decode, including
+// the work done up to the point of failure if it returned an error.
+func (dec *Decoder) Stats() DecodeStats {
+	return dec.stats
+}
+
 // Decode reads the next YAML-encoded value from its input
 // and stores it in the value pointed to by v.
 //
 // See the documentation for Unmarshal for details about the
 // conversion of YAML into a Go value.
 func (dec *Decoder) Decode(v interface{}) (err error) {
-	d := newDecoder()
-	d.knownFields = dec.knownFields
+	if dec.inSequence {
+		return errors.New("yaml: Decode called while decoding sequence elements")
+	}
+	d := dec.decoder()
 	defer handleErr(&err)
+	defer func() { dec.stats = d.stats }()
+	dec.countDocument()
 	node := dec.parser.parse()
 	if node == nil {
 		return io.EOF
 	}
+	if dec.includeResolver != nil {
+		resolveIncludes(node, dec.includeResolver, nil)
+	}
 	out := reflect.ValueOf(v)
 	if out.Kind() == reflect.Ptr && !out.IsNil() {
 		out = out.Elem()
 	}
+	if dec.emptyDocAs != EmptyDocNil && isEmptyDocument(node) {
+		if dec.emptyDocAs == EmptyDocError {
+			return ErrEmptyDocument
+		}
+		if out.CanSet() {
+			out.Set(reflect.Zero(out.Type()))
+		}
+		return nil
+	}
 	d.unmarshal(node, out)
 	if len(d.terrors) > 0 {
 		return &TypeError{d.terrors}
@@ -157,6 +575,109 @@ func (dec *Decoder) Decode(v interface{}) (err error) {
 	return nil
 }
 
+// DecodeArrayElement reads the next element of a top-level sequence from
+// its input and stores it in the value pointed to by v, so that a long
+// sequence may be processed without holding all of it in memory.
+//
+// The first call reads the start of the next document, which must hold
+// a sequence. Once all elements of that sequence were returned, the call
+// consumes the end of the document and returns io.EOF. A following call
+// starts over with the next document, if any.
+//
+// See the documentation for Unmarshal for details about the
+// conversion of YAML into a Go value.
+func (dec *Decoder) DecodeArrayElement(v interface{}) (err error) {
+	d := dec.decoder()
+	defer handleErr(&err)
+	defer func() { dec.stats = d.stats }()
+	p := dec.parser
+	p.init()
+	if !dec.inSequence {
+		dec.countDocument()
+		if p.peek() == yaml_STREAM_END_EVENT {
+			return io.EOF
+		}
+		doc := p.node(DocumentNode, "", "", "")
+		p.doc = doc
+		p.expect(yaml_DOCUMENT_START_EVENT)
+		if p.peek() != yaml_SEQUENCE_START_EVENT {
+			failf("line %d: document root is not a sequence", p.event.start_mark.line+1)
+		}
+		doc.Content = []*Node{p.node(SequenceNode, seqTag, string(p.event.tag), "")}
+		p.anchor(doc.Content[0], p.event.anchor)
+		p.expect(yaml_SEQUENCE_START_EVENT)
+		dec.inSequence = true
+	}
+	if p.peek() == yaml_SEQUENCE_END_EVENT {
+		p.expect(yaml_SEQUENCE_END_EVENT)
+		p.expect(yaml_DOCUMENT_END_EVENT)
+		dec.inSequence = false
+		return io.EOF
+	}
+	node := p.parse()
+	if dec.includeResolver != nil {
+		resolveIncludes(node, dec.includeResolver, nil)
+	}
+	out := reflect.ValueOf(v)
+	if out.Kind() == reflect.Ptr && !out.IsNil() {
+		out = out.Elem()
+	}
+	d.unmarshal(node, out)
+	if len(d.terrors) > 0 {
+		return &TypeError{d.terrors}
+	}
+	return nil
+}
+
+// DecodeToChannel decodes the elements of a top-level sequence from its
+// input one at a time, as DecodeArrayElement does, and sends each of them
+// on ch, which must be a channel the elements can be decoded as values of,
+// such as a chan int. It returns once the sequence of the next document
+// was fully read, or at the first error, closing ch in either case so that
+// consumers ranging over it finish. As sends block until received, it's
+// usually run in its own goroutine.
+func (dec *Decoder) DecodeToChannel(ch interface{}) error {
+	cv := reflect.ValueOf(ch)
+	if cv.Kind() != reflect.Chan || cv.Type().ChanDir()&reflect.SendDir == 0 || cv.IsNil() {
+		return fmt.Errorf("yaml: cannot decode sequence elements into %T, which isn't a channel to send on", ch)
+	}
+	defer cv.Close()
+	for {
+		elem := reflect.New(cv.Type().Elem())
+		err := dec.DecodeArrayElement(elem.Interface())
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		cv.Send(elem.Elem())
+	}
+}
+
+// decoder returns a decoder configured with the options of dec.
+func (dec *Decoder) decoder() *decoder {
+	d := newDecoder()
+	d.knownFields = dec.knownFields
+	d.keyNormalizer = dec.keyNormalizer
+	d.defaulter = dec.defaulter
+	d.discriminatorKey = dec.discriminatorKey
+	d.discriminator = dec.discriminator
+	d.registeredTypes = dec.registeredTypes
+	d.keepUnknownTags = dec.keepUnknownTags
+	d.decodeHooks = dec.decodeHooks
+	d.unwrapSingletonSeq = dec.unwrapSingletonSeq
+	d.leadingZeroStrings = dec.leadingZeroStrings
+	d.timeFormats = dec.timeFormats
+	d.warningHandler = dec.warningHandler
+	d.mergeWarnings = dec.mergeWarnings
+	if dec.recordRawText && dec.parser.raw == nil {
+		dec.parser.raw = &rawRecorder{r: dec.parser.parser.input_reader}
+		dec.parser.parser.input_reader = dec.parser.raw
+	}
+	return d
+}
+
 // Decode decodes the node and stores its data into the value pointed to by v.
 //
 // See the documentation for Unmarshal for details about the
@@ -220,16 +741,50 @@ func unmarshal(in []byte, out interface{}, strict bool) (err error) {
 //                  method (see the IsZeroer interface type), in which
 //                  case the field will be excluded if IsZero returns true.
 //
+//     keepzero     Include the field even when set to the zero value, for
+//                  encoders omitting zero fields after Encoder.SetOmitZero.
+//
 //     flow         Marshal using a flow style (useful for structs,
 //                  sequences and maps).
 //
+//     bytes        Marshal an integer as a size in bytes with the largest
+//                  exact IEC (Ki, Mi, ...) or SI (k, M, ...) suffix, as in
+//                  256Mi. Such suffixes are also accepted when unmarshaling.
+//
+//     unix         Marshal a time.Time as an integer number of seconds since
+//                  the Unix epoch. Such integers, as well as timestamps, are
+//                  accepted when unmarshaling, and decode to UTC times.
+//
+//     unixmilli    Like unix, with milliseconds rather than seconds.
+//
+//     alias=<key>  Also accept <key> for the field when unmarshaling, as
+//                  for keys renamed over versions. It may be repeated. The
+//                  field's own key wins when both are present. Marshaling
+//                  always uses the field's own key.
+//
 //     inline       Inline the field, which must be a struct or a map,
 //                  causing all of its fields or keys to be processed as if
 //                  they were part of the outer struct. For maps, keys must
 //                  not conflict with the yaml keys of other struct fields.
 //
+//     remain       Same as inline. On a map, it names the intent of holding
+//                  all keys not matching other fields of the struct when
+//                  unmarshaling, which get marshaled along with them. Such
+//                  keys are not errors with KnownFields.
+//
+//     node         Only valid with the "-" key on a yaml.Node or *yaml.Node
+//                  field, which is then ignored when marshaling and set to
+//                  the mapping node the struct is unmarshaled from, so that
+//                  its position may be reported after decoding.
+//
 // In addition, if the key is "-", the field is ignored.
 //
+// Values implementing encoding.TextMarshaler, such as net.IP, are marshalled
+// as the text they return, and are unmarshalled with UnmarshalText when they
+// implement encoding.TextUnmarshaler. A time.Duration is marshalled as in
+// "1m30s", and a url.URL as its string form, both being accepted back when
+// unmarshalling.
+//
 // For example:
 //
 //     type T struct {
@@ -249,6 +804,34 @@ func Marshal(in interface{}) (out []byte, err error) {
 	return
 }
 
+// MarshalNode serializes n into a YAML document, just like encoding it
+// with an Encoder configured by the provided options and then closed.
+func MarshalNode(n *Node, opts ...Option) (out []byte, err error) {
+	defer handleErr(&err)
+	e := &Encoder{
+		encoder:            newEncoder(),
+		preserveBlankLines: PreserveBlankLines,
+	}
+	defer e.encoder.destroy()
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.encoder.marshalDoc("", reflect.ValueOf(n))
+	e.encoder.finish()
+	out = e.encoder.out
+	return
+}
+
+// Render returns the YAML text of the tree rooted at n, which needn't be
+// a document, as produced by MarshalNode with the same options. It's
+// meant for logging and debugging subtrees. Aliases within the tree to
+// anchors outside of it are rendered as they are, so the text might not
+// decode on its own then.
+func (n *Node) Render(opts ...Option) (string, error) {
+	out, err := MarshalNode(n, opts...)
+	return string(out), err
+}
+
 // An Encoder writes YAML values to an output stream.
 type Encoder struct {
 	encoder            *encoder
@@ -281,6 +864,54 @@ func (e *Encoder) Encode(v interface{}) (err error) {
 	return nil
 }
 
+// A SequenceEncoder writes the items of a top-level sequence to the
+// stream of an Encoder one at a time, so that the whole sequence doesn't
+// need to be held in memory. It's obtained from Encoder.BeginSequence.
+type SequenceEncoder struct {
+	encoder *encoder
+	err     error
+}
+
+// BeginSequence starts a new document holding a block sequence whose
+// items are then provided to the returned SequenceEncoder. No other
+// value may be encoded until the sequence has been ended.
+func (e *Encoder) BeginSequence() *SequenceEncoder {
+	s := &SequenceEncoder{encoder: e.encoder}
+	func() {
+		defer handleErr(&s.err)
+		e.encoder.refs, e.encoder.anchors = nil, nil
+		e.encoder.init()
+		yaml_document_start_event_initialize(&e.encoder.event, nil, nil, true)
+		e.encoder.emit()
+		e.encoder.must(yaml_sequence_start_event_initialize(&e.encoder.event, nil, nil, true, yaml_BLOCK_SEQUENCE_STYLE))
+		e.encoder.emit()
+	}()
+	return s
+}
+
+// Encode writes the YAML encoding of v as the next item of the sequence.
+func (s *SequenceEncoder) Encode(v interface{}) (err error) {
+	if s.err != nil {
+		return s.err
+	}
+	defer handleErr(&err)
+	s.encoder.marshal("", reflect.ValueOf(v))
+	return nil
+}
+
+// End terminates the sequence and its document.
+func (s *SequenceEncoder) End() (err error) {
+	if s.err != nil {
+		return s.err
+	}
+	defer handleErr(&err)
+	s.encoder.must(yaml_sequence_end_event_initialize(&s.encoder.event))
+	s.encoder.emit()
+	yaml_document_end_event_initialize(&s.encoder.event, true)
+	s.encoder.emit()
+	return nil
+}
+
 // Encode encodes value v and stores its representation in n.
 //
 // See the documentation for Marshal for details about the
@@ -307,6 +938,157 @@ func (e *Encoder) SetIndent(spaces int) {
 	e.encoder.indent = spaces
 }
 
+// SetLineEnding changes the line break written at the end of every line,
+// including those within block scalars. It must be one of "\n", the
+// default, "\r\n" or "\r".
+func (e *Encoder) SetLineEnding(ending string) {
+	switch ending {
+	case "\n":
+		yaml_emitter_set_break(&e.encoder.emitter, yaml_LN_BREAK)
+	case "\r\n":
+		yaml_emitter_set_break(&e.encoder.emitter, yaml_CRLN_BREAK)
+	case "\r":
+		yaml_emitter_set_break(&e.encoder.emitter, yaml_CR_BREAK)
+	default:
+		panic(fmt.Sprintf("yaml: unsupported line ending %q", ending))
+	}
+}
+
+// CommentIndent selects how head and foot comments are indented when
+// encoding, as set with Encoder.SetCommentIndent.
+type CommentIndent int
+
+const (
+	// NodeIndent indents comments as the node they belong to.
+	NodeIndent CommentIndent = iota
+
+	// FlushLeft writes comments at the first column regardless of the
+	// depth of the node they belong to.
+	FlushLeft
+)
+
+// SetCommentIndent changes the indentation of head and foot comments.
+// It defaults to NodeIndent. Line comments are not affected.
+func (e *Encoder) SetCommentIndent(mode CommentIndent) {
+	switch mode {
+	case NodeIndent, FlushLeft:
+		e.encoder.emitter.comments_flush_left = mode == FlushLeft
+	default:
+		panic(fmt.Sprintf("yaml: unsupported comment indent %d", mode))
+	}
+}
+
+// SetAnchorOrderCheck controls whether encoding fails with a clear error
+// when an alias would be written before the anchor it refers to, as may
+// happen with Node trees built by hand, rather than producing a document
+// which can't be decoded. Anchors written in earlier documents of the
+// stream count as defined, as Decoder and Valid keep anchors from one
+// document to the next.
+func (e *Encoder) SetAnchorOrderCheck(enable bool) {
+	e.encoder.checkAnchorOrder = enable
+}
+
+// SetCommentWidth makes head and foot comments wrap at spaces between
+// words so that their lines don't go past n columns, indentation included,
+// each wrapped line starting with "# " again. Words longer than that, such
+// as URLs, aren't broken. A width of zero or less disables wrapping, which
+// is the default. Line comments are never wrapped.
+func (e *Encoder) SetCommentWidth(n int) {
+	if n < 0 {
+		n = 0
+	}
+	e.encoder.emitter.comment_width = n
+}
+
+// SetMultilineStrings controls whether all multi-line strings are written
+// as literal blocks wherever they may be, making them easier to read.
+// By default, strings with spaces at the end of some of their lines are
+// written double-quoted instead, as such spaces are easily lost when
+// editing blocks. Strings with characters which can't be written
+// unescaped, and strings within flow collections or keys are written
+// double-quoted regardless.
+func (e *Encoder) SetMultilineStrings(enable bool) {
+	e.encoder.emitter.multiline_literal = enable
+}
+
+// FlowWrap selects how lines are broken within flow collections when
+// encoding, as set with Encoder.SetFlowWrap.
+type FlowWrap int
+
+const (
+	// FlowWrapNever writes flow collections on a single line, however long.
+	FlowWrapNever FlowWrap = iota
+
+	// FlowWrapEach writes every entry of flow collections on its own line,
+	// indented one level deeper than the line opening the collection.
+	// Empty collections are still written as [] and {}.
+	FlowWrapEach
+)
+
+// SetFlowWrap changes how lines are broken within flow collections.
+// It defaults to FlowWrapNever.
+func (e *Encoder) SetFlowWrap(mode FlowWrap) {
+	switch mode {
+	case FlowWrapNever, FlowWrapEach:
+		e.encoder.emitter.flow_wrap_each = mode == FlowWrapEach
+	default:
+		panic(fmt.Sprintf("yaml: unsupported flow wrap %d", mode))
+	}
+}
+
+// SetFlowTrailingComma controls whether a comma is written after the last
+// entry of flow collections broken over several lines, as accepted by YAML
+// and required by some consumers. As only FlowWrapEach breaks the lines of
+// flow collections with their closing bracket on its own line, it has no
+// effect with other modes of SetFlowWrap.
+func (e *Encoder) SetFlowTrailingComma(enable bool) {
+	e.encoder.emitter.flow_trailing_comma = enable
+}
+
+// SetSequenceItemSpacing makes the encoder write at least n blank lines
+// between the items of block sequences, for the readability of long lists.
+// When blank lines are preserved, items preceded by more of them keep
+// these. A spacing of zero or less disables it, which is the default.
+func (e *Encoder) SetSequenceItemSpacing(n int) {
+	if n < 0 {
+		n = 0
+	}
+	e.encoder.emitter.sequence_item_spacing = n
+}
+
+// SetEscapeFunc sets a function choosing the text written for characters
+// within double-quoted scalars, for consumers which can't read some escape
+// sequences or which need others. When it returns true for a character,
+// the text returned is written in its place as is, and must be valid
+// within double quotes, such as `\u00E9` for "é". Scalars holding such
+// characters are always written double-quoted. Characters for which it
+// returns false are escaped as usual.
+func (e *Encoder) SetEscapeFunc(fn func(r rune) (string, bool)) {
+	e.encoder.emitter.escape_func = fn
+}
+
+// SetBlockScalarIndent makes the encoder write the content of literal
+// and folded block scalars n spaces deeper than the node holding them,
+// stating it with an indentation indicator as in "|2". It must be between
+// 1 and 9, or 0 for the default of using the encoder indentation and only
+// writing the indicator where the content requires it. Nodes decoded with
+// an indicator of their own, recorded in Node.BlockIndent, keep it.
+func (e *Encoder) SetBlockScalarIndent(n int) {
+	if n < 0 || n > 9 {
+		panic("yaml: block scalar indent must be between 0 and 9")
+	}
+	e.encoder.emitter.block_scalar_indent = n
+}
+
+// SetBlankAfterHeadComment controls whether head comments spanning
+// several lines are always followed by exactly one blank line, separating
+// them from the node they precede. When enabled, this takes precedence over
+// the blank lines recorded after such comments when blank lines are
+// preserved. Single line head comments are left as they are.
+func (e *Encoder) SetBlankAfterHeadComment(enable bool) {
+	e.encoder.emitter.blank_after_head_comment = enable
+}
+
 // SetPreserveBlankLines controls whether the encoder outputs blank lines
 // from Node structs during encoding. When enabled, the encoder will output
 // BlankLinesBefore and BlankLinesAfter as specified in the Node fields.
@@ -318,6 +1100,234 @@ func (e *Encoder) SetPreserveBlankLines(enable bool) {
 	}
 }
 
+// SetMapAsSeqOfPairs controls whether Go maps are encoded as a sequence of
+// single-key mappings, one for each entry in key order, rather than as a
+// single mapping. This suits schemas which rely on the order of entries
+// being kept by tools that don't preserve mapping order.
+func (e *Encoder) SetMapAsSeqOfPairs(enable bool) {
+	e.encoder.mapAsSeqOfPairs = enable
+}
+
+// SetKeepExplicitTags controls whether the !!str tag of a scalar node
+// whose value would otherwise resolve to another type is kept, as in
+// "!!str 1.0", rather than dropped in favor of quoting the value.
+// Tags flagged with TaggedStyle, such as those written explicitly in a
+// decoded document, are kept in any case.
+func (e *Encoder) SetKeepExplicitTags(enable bool) {
+	e.encoder.keepExplicitTags = enable
+}
+
+// SetExplicitTags controls whether strings which other parsers might read
+// as values of another type are written with an explicit !!str tag, as in
+// "!!str yes" or "!!str 1.0", rather than quoted. This covers strings that
+// would otherwise resolve to numbers, booleans or nulls, as well as those
+// resolved differently by YAML 1.1 parsers, such as "yes", "off" or "1:20".
+// Values of other types, and strings which can't be mistaken, stay bare.
+func (e *Encoder) SetExplicitTags(enable bool) {
+	e.encoder.explicitTags = enable
+}
+
+// SetAutoAnchors controls whether values referenced by the same pointer
+// more than once within a document are encoded only once. When enabled,
+// the first occurrence is given an anchor and following ones become
+// aliases to it, which also allows encoding values with reference cycles.
+// Each document is encoded on its own, with no aliases to the values of
+// the documents before it.
+func (e *Encoder) SetAutoAnchors(enable bool) {
+	e.encoder.autoAnchors = enable
+}
+
+// SetAnchorNames sets the function naming the anchors added with
+// SetAutoAnchors, which is called with the number of each anchor within
+// its document, counting from 1 in the order they're written. As values
+// are always encoded in the same order, with map keys sorted, encoding the
+// same value gives the same names every time. The names returned must be
+// valid anchors, unique within the document. They default to id001, id002
+// and so on, which a nil fn restores.
+func (e *Encoder) SetAnchorNames(fn func(i int) string) {
+	e.encoder.anchorName = fn
+}
+
+// SetOmitZero controls whether all struct fields holding zero values,
+// such as zero numbers, false booleans and empty strings, are omitted
+// as if they had the omitempty flag. Fields with the keepzero flag are
+// encoded regardless.
+func (e *Encoder) SetOmitZero(enable bool) {
+	e.encoder.omitZero = enable
+}
+
+// SetQuoteKeys controls whether all string mapping keys are written
+// double-quoted, even when they could be written plain. Keys of other
+// types, such as numbers, are left as they are, so that they decode into
+// the same values. Keys which need quoting, such as "a: b" or "- x",
+// are quoted regardless. It replaces any quoting of keys set before with
+// SetMappingKeyQuoteStyle, and the other way around, so the last call to
+// either decides.
+func (e *Encoder) SetQuoteKeys(enable bool) {
+	if enable {
+		e.setKeyStyle(yaml_DOUBLE_QUOTED_SCALAR_STYLE, false)
+	} else {
+		e.setKeyStyle(0, false)
+	}
+}
+
+// SetMappingKeyQuoteStyle forces all scalar mapping keys to be written with
+// the given style, which must be SingleQuotedStyle or DoubleQuotedStyle, or
+// zero to stop forcing it. Unlike with SetQuoteKeys, keys of any type are
+// quoted, so that numbers or booleans used as keys decode back as strings.
+// Keys which can't be written single-quoted are double-quoted, and values
+// are not affected. As with SetQuoteKeys, the last call to either decides
+// how keys are quoted, so that zero stops the quoting set by SetQuoteKeys
+// as well.
+func (e *Encoder) SetMappingKeyQuoteStyle(style Style) {
+	switch style {
+	case 0:
+		e.setKeyStyle(0, false)
+	case SingleQuotedStyle:
+		e.setKeyStyle(yaml_SINGLE_QUOTED_SCALAR_STYLE, true)
+	case DoubleQuotedStyle:
+		e.setKeyStyle(yaml_DOUBLE_QUOTED_SCALAR_STYLE, true)
+	default:
+		panic(fmt.Sprintf("yaml: unsupported mapping key quote style %d", style))
+	}
+}
+
+// setKeyStyle sets the style of quotes forced on keys, for string keys
+// only unless all is set, replacing the one set before.
+func (e *Encoder) setKeyStyle(style yaml_scalar_style_t, all bool) {
+	e.encoder.keyStyle, e.encoder.quoteAllKeys = style, all
+}
+
+// SetValueQuoteStyle forces all string values, as opposed to mapping keys,
+// to be written with the given style, which must be SingleQuotedStyle or
+// DoubleQuotedStyle, or zero to stop forcing it. Values of other types,
+// such as numbers or booleans, are left plain so that they decode into the
+// same values, and strings written as literal or folded blocks are kept
+// so. Values which can't be written single-quoted, such as those holding
+// tabs, are double-quoted. Keys are quoted as set with SetQuoteKeys or SetMappingKeyQuoteStyle,
+// which is only when needed by default.
+func (e *Encoder) SetValueQuoteStyle(style Style) {
+	switch style {
+	case 0:
+		e.encoder.valueStyle = 0
+	case SingleQuotedStyle:
+		e.encoder.valueStyle = yaml_SINGLE_QUOTED_SCALAR_STYLE
+	case DoubleQuotedStyle:
+		e.encoder.valueStyle = yaml_DOUBLE_QUOTED_SCALAR_STYLE
+	default:
+		panic(fmt.Sprintf("yaml: unsupported value quote style %d", style))
+	}
+}
+
+// KeywordCase selects how booleans and nulls are spelled when encoding,
+// as set with Encoder.SetKeywordCase.
+type KeywordCase int
+
+const (
+	// KeepCase writes Go booleans and nils as "true", "false" and
+	// "null", and Node scalars as they are spelled.
+	KeepCase KeywordCase = iota
+
+	// LowerCase writes "true", "false" and "null".
+	LowerCase
+
+	// TitleCase writes "True", "False" and "Null".
+	TitleCase
+
+	// UpperCase writes "TRUE", "FALSE" and "NULL".
+	UpperCase
+)
+
+// SetKeywordCase changes the case in which booleans and nulls are
+// written, for consumers expecting a particular spelling. Besides Go
+// booleans and nils, it applies to plain Node scalars resolving to them,
+// except for nulls written as "~" or left empty. It defaults to KeepCase.
+func (e *Encoder) SetKeywordCase(c KeywordCase) {
+	switch c {
+	case KeepCase, LowerCase, TitleCase, UpperCase:
+		e.encoder.keywordCase = c
+	default:
+		panic(fmt.Sprintf("yaml: unsupported keyword case %d", c))
+	}
+}
+
+// A NormalizationForm rewrites text in a Unicode normalization form, as
+// the forms of golang.org/x/text/unicode/norm do, such as norm.NFC.
+type NormalizationForm interface {
+	String(s string) string
+}
+
+// SetUnicodeNormalization makes the encoder write the text of all scalars,
+// keys included, in the given Unicode normalization form, so that strings
+// differing only in how their characters are composed are written as the
+// same bytes. With norm.NFC, "e" followed by a combining acute accent is
+// written as "é". Comments are written as they are. A nil form, which is
+// the default, leaves text unchanged.
+func (e *Encoder) SetUnicodeNormalization(form NormalizationForm) {
+	e.encoder.normalization = form
+}
+
+// SetCompactMerges controls whether entries repeated across the mappings
+// of a sequence, or across the mappings held by another mapping, are
+// written only once. When at least two entries are shared by all of them,
+// these are moved into a mapping anchored as "base" and merged into the
+// first one with the "<<" key, and the others merge it through an alias.
+// Decoding the output still yields the same values.
+func (e *Encoder) SetCompactMerges(enable bool) {
+	e.encoder.compactMerges = enable
+}
+
+// SetMaxCollectionItems limits the number of items of sequences and
+// entries of mappings encoded to n, for producing previews of large
+// documents. The ones left out are replaced by a comment such as
+// "# ... 95 more" after the last one kept. Values and nodes provided
+// to Encode are not modified. A limit of zero or less disables it.
+func (e *Encoder) SetMaxCollectionItems(n int) {
+	e.encoder.maxItems = n
+}
+
+// SetTopLevelSpacing makes the encoder separate the entries of top-level
+// mappings with exactly n blank lines, removing all other blank lines,
+// including those recorded in nodes, regardless of blank line
+// preservation. A negative n disables it, which is the default.
+func (e *Encoder) SetTopLevelSpacing(n int) {
+	e.encoder.spaceTopLevel = n >= 0
+	e.encoder.topLevelSpacing = n
+}
+
+// SetVerify controls whether every document written is parsed back and
+// decoded into a new value of the type encoded, or into an interface for
+// nodes, failing the call to Encode if the result doesn't hold the same
+// data as the value encoded. This catches values the encoder writes
+// incorrectly, and is meant for debugging and testing. The document is
+// still written when the check fails. Nil and empty collections compare
+// equal, and so do numbers of different types with the same value.
+// Values whose marshaling isn't undone by unmarshaling, such as those of
+// types implementing Marshaler alone, or those changed by settings like
+// SetMaxCollectionItems, fail the check.
+func (e *Encoder) SetVerify(enable bool) {
+	e.encoder.verify = enable
+}
+
+// An Option configures an Encoder for functions which create one
+// internally, such as MarshalNode. Any Encoder setter may be used
+// through a function literal:
+//
+//     yaml.MarshalNode(n, func(e *yaml.Encoder) { e.SetAutoAnchors(true) })
+//
+type Option func(e *Encoder)
+
+// WithIndent returns an Option calling SetIndent with spaces.
+func WithIndent(spaces int) Option {
+	return func(e *Encoder) { e.SetIndent(spaces) }
+}
+
+// WithPreserveBlankLines returns an Option calling SetPreserveBlankLines
+// with enable.
+func WithPreserveBlankLines(enable bool) Option {
+	return func(e *Encoder) { e.SetPreserveBlankLines(enable) }
+}
+
 // Close closes the encoder by writing any remaining data.
 // It does not write a stream terminating string "...".
 func (e *Encoder) Close() (err error) {
@@ -360,6 +1370,26 @@ func (e *TypeError) Error() string {
 	return fmt.Sprintf("yaml: unmarshal errors:\n  %s", strings.Join(e.Errors, "\n  "))
 }
 
+// A ValidationError is returned by Unmarshal when the ValidateYAML method
+// of a value rejects it, telling where that value is in the document.
+type ValidationError struct {
+	Path   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("yaml: line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("yaml: line %d: %s: %v", e.Line, e.Path, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
 type Kind uint32
 
 const (
@@ -430,6 +1460,13 @@ type Node struct {
 	// Value holds the unescaped and unquoted represenation of the value.
 	Value string
 
+	// RawValue holds the text of a scalar exactly as found in the decoded
+	// YAML text, including quotes and escapes but not its tag or anchor.
+	// Block scalars span from their indicator to the end of their last
+	// non-empty line. It's only recorded by decoders set with
+	// Decoder.SetRecordRawText, and isn't respected when encoding.
+	RawValue string
+
 	// Anchor holds the anchor name for this node, which allows aliases to point to it.
 	Anchor string
 
@@ -447,6 +1484,9 @@ type Node struct {
 	LineComment string
 
 	// FootComment holds any comments following the node and before empty lines.
+	// On documents, it holds the comments following all of their content,
+	// separated from it by an empty line, which are written after the content
+	// and before the "..." or "---" marker ending the document, if any.
 	FootComment string
 
 	// Line and Column hold the node position in the decoded YAML text.
@@ -462,15 +1502,230 @@ type Node struct {
 	// Used primarily for sequence and mapping items to preserve spacing.
 	// Only tracked when PreserveBlankLines is enabled.
 	BlankLinesAfter int
+
+	// BlockIndent holds the indentation indicator of literal and folded
+	// scalars, such as 2 for "|2", or 0 if they have none. When encoding,
+	// a block scalar with it set is written with that indicator and its
+	// content indented accordingly.
+	BlockIndent int
+
+	// TagDirectives holds the %TAG directives of document nodes, which
+	// declare tag handles such as "!e!" as shorthands for tag prefixes.
+	// The tags of nodes within the document are still held in full, and
+	// written with the handles again when encoding the document.
+	TagDirectives []TagDirective
+
+	// source records the node as decoded by UnmarshalPreserving.
+	source *nodeSource
+}
+
+// A TagDirective declares a tag handle standing for a tag prefix within
+// a document, as in "%TAG !e! tag:example.com,2024:".
+type TagDirective struct {
+	// Handle is the tag handle, such as "!e!".
+	Handle string
+
+	// Prefix is the text the handle stands for, such as
+	// "tag:example.com,2024:".
+	Prefix string
 }
 
 // IsZero returns whether the node has all of its fields unset.
 func (n *Node) IsZero() bool {
-	return n.Kind == 0 && n.Style == 0 && n.Tag == "" && n.Value == "" && n.Anchor == "" && n.Alias == nil && n.Content == nil &&
+	return n.Kind == 0 && n.Style == 0 && n.Tag == "" && n.Value == "" && n.RawValue == "" && n.Anchor == "" && n.Alias == nil && n.Content == nil &&
 		n.HeadComment == "" && n.LineComment == "" && n.FootComment == "" && n.Line == 0 && n.Column == 0 &&
-		n.BlankLinesBefore == 0 && n.BlankLinesAfter == 0
+		n.BlankLinesBefore == 0 && n.BlankLinesAfter == 0 && n.BlockIndent == 0 && n.TagDirectives == nil
+}
+
+// IsNull returns whether the node is a null scalar, such as "~", "null",
+// "Null", "NULL", an empty plain scalar or one explicitly tagged as !!null.
+// Aliases are followed, and the zero Node counts as null as it's encoded
+// as such.
+func (n *Node) IsNull() bool {
+	switch n.Kind {
+	case AliasNode:
+		return n.Alias != nil && n.Alias.IsNull()
+	case ScalarNode:
+		return n.ShortTag() == nullTag
+	case 0:
+		return n.IsZero()
+	}
+	return false
+}
+
+// NullStyle tells how a null value is spelled, as reported by
+// Node.NullStyle.
+type NullStyle int
+
+const (
+	// NotNull is reported for nodes which aren't nulls.
+	NotNull NullStyle = iota
+
+	// EmptyNull is an empty value, as in "a:" or "!!null ''".
+	EmptyNull
+
+	// TildeNull is spelled "~".
+	TildeNull
+
+	// WordNull is spelled "null", "Null" or "NULL", or with any other
+	// text explicitly tagged as !!null.
+	WordNull
+)
+
+// NullStyle returns how the null held by the node is spelled, so that
+// for example "~" and "null" may be told apart when they have different
+// meanings to the application, or NotNull if the node isn't a null, as
+// reported by IsNull. Aliases are followed, and the zero Node is an
+// EmptyNull.
+func (n *Node) NullStyle() NullStyle {
+	for n.Kind == AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	if !n.IsNull() {
+		return NotNull
+	}
+	switch n.Value {
+	case "":
+		return EmptyNull
+	case "~":
+		return TildeNull
+	}
+	return WordNull
+}
+
+// IsZeroValue returns whether the node holds the zero value of its type:
+// null, false, a zero number, an empty string or an empty collection.
+// Aliases are followed. Unlike IsZero, it concerns the value represented
+// by the node rather than the fields of the Node itself.
+func (n *Node) IsZeroValue() bool {
+	switch n.Kind {
+	case AliasNode:
+		return n.Alias != nil && n.Alias.IsZeroValue()
+	case SequenceNode, MappingNode:
+		return len(n.Content) == 0
+	case ScalarNode:
+		var v interface{}
+		if n.Decode(&v) != nil {
+			return false
+		}
+		if v == nil {
+			return true
+		}
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Slice {
+			return rv.Len() == 0
+		}
+		return rv.IsZero()
+	case 0:
+		return n.IsZero()
+	}
+	return false
+}
+
+// EqualValue returns whether decoding the node into a value of the same
+// type as v results in a value deeply equal to v, as with reflect.DeepEqual.
+// A nil v matches null values only. It returns false if the node can't be
+// decoded into that type.
+func (n *Node) EqualValue(v interface{}) bool {
+	if v == nil {
+		var out interface{}
+		return n.Decode(&out) == nil && out == nil
+	}
+	out := reflect.New(reflect.TypeOf(v))
+	if n.Decode(out.Interface()) != nil {
+		return false
+	}
+	return reflect.DeepEqual(out.Elem().Interface(), v)
+}
+
+// FindAll returns all nodes within the tree rooted at n, n included,
+// for which pred returns true, in document order. Aliases are reported
+// like any other node but not followed, so nodes reached through several
+// aliases are only reported once.
+func (n *Node) FindAll(pred func(*Node) bool) []*Node {
+	var found []*Node
+	var find func(n *Node)
+	find = func(n *Node) {
+		if pred(n) {
+			found = append(found, n)
+		}
+		for _, c := range n.Content {
+			find(c)
+		}
+	}
+	find(n)
+	return found
+}
+
+// ResolvedValue returns the Go value held by a scalar node, or by the
+// scalar an alias node refers to, as it would be decoded into an empty
+// interface: an int for 42, a bool for true, a string for abc, and so on.
+func (n *Node) ResolvedValue() (interface{}, error) {
+	for n.Kind == AliasNode && n.Alias != nil {
+		n = n.Alias
+	}
+	if n.Kind != ScalarNode {
+		return nil, errors.New("yaml: ResolvedValue needs a scalar node")
+	}
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+
+// TagImplicit returns whether the tag of the node was inferred by the
+// resolver or from the style of the node, rather than written explicitly,
+// as in "!!str 1" or "!point {x: 1}". Explicit tags are recorded by the
+// decoder with TaggedStyle, and only those are written back when encoding
+// the node, unless its tag doesn't match how its value resolves or the
+// encoder was set to add them with SetExplicitTags or SetKeepExplicitTags.
+func (n *Node) TagImplicit() bool {
+	return n.Style&TaggedStyle == 0
+}
+
+// Describe returns a short description of the node for error messages
+// and logs, such as `mapping(!!map, 3 keys)`, `scalar(!!int "42")` or
+// `alias(*base -> mapping(!!map, 2 keys))`. Anchors are included, and
+// long scalar values are shortened.
+func (n *Node) Describe() string {
+	var anchor string
+	if n.Anchor != "" {
+		anchor = "&" + n.Anchor + " "
+	}
+	switch n.Kind {
+	case DocumentNode:
+		if len(n.Content) == 0 {
+			return "document(empty)"
+		}
+		return "document(" + n.Content[0].Describe() + ")"
+	case MappingNode:
+		return fmt.Sprintf("mapping(%s%s, %s)", anchor, n.ShortTag(), plural(len(n.Content)/2, "key"))
+	case SequenceNode:
+		return fmt.Sprintf("sequence(%s%s, %s)", anchor, n.ShortTag(), plural(len(n.Content), "item"))
+	case ScalarNode:
+		value := n.Value
+		if utf8.RuneCountInString(value) > 40 {
+			value = string([]rune(value)[:37]) + "..."
+		}
+		return fmt.Sprintf("scalar(%s%s %q)", anchor, n.ShortTag(), value)
+	case AliasNode:
+		if n.Alias == nil {
+			return "alias(*" + n.Value + ")"
+		}
+		return "alias(*" + n.Value + " -> " + n.Alias.Describe() + ")"
+	}
+	return fmt.Sprintf("unknown(kind %d)", n.Kind)
 }
 
+// plural returns n followed by noun, in the plural unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
 
 // LongTag returns the long form of the tag that indicates the data type for
 // the node. If the Tag field isn't explicitly defined, one will be computed
@@ -532,6 +1787,32 @@ func (n *Node) SetString(s string) {
 	}
 }
 
+// SetScalarValue makes the node a scalar holding v, keeping its style,
+// comments and blank lines so that updating a value in a decoded document
+// leaves the text around it as it was. Unless the node is explicitly
+// tagged, its tag is resolved again from v: plain scalars get the tag v
+// resolves to, as with 8080 for !!int, while quoted and block scalars are
+// strings.
+func (n *Node) SetScalarValue(v string) {
+	if n.Kind != ScalarNode {
+		n.Kind = ScalarNode
+		n.Style &^= FlowStyle
+		n.Tag = ""
+		n.Content = nil
+		n.Alias = nil
+	}
+	n.Value = v
+	n.RawValue = ""
+	if n.Style&TaggedStyle != 0 && n.Tag != "" {
+		return
+	}
+	if n.Style&(SingleQuotedStyle|DoubleQuotedStyle|LiteralStyle|FoldedStyle) != 0 {
+		n.Tag = strTag
+	} else {
+		n.Tag, _ = resolve("", v)
+	}
+}
+
 // --------------------------------------------------------------------------
 // Maintain a mapping of keys to structure field indexes
 
@@ -550,13 +1831,28 @@ type structInfo struct {
 	// InlineUnmarshalers holds indexes to inlined fields that
 	// contain unmarshaler values.
 	InlineUnmarshalers [][]int
+
+	// NodeField is the number of the field in the struct that
+	// receives the node it's decoded from, or -1 if there's none.
+	NodeField int
+
+	// Aliases maps the alternative keys given with the alias flag
+	// to the keys of their fields.
+	Aliases map[string]string
 }
 
 type fieldInfo struct {
 	Key       string
 	Num       int
 	OmitEmpty bool
+	KeepZero  bool
 	Flow      bool
+	Bytes     bool
+
+	// Epoch is the unit of the integer a time.Time field is marshaled
+	// as a Unix time with, or zero if it isn't.
+	Epoch time.Duration
+
 	// Id holds the unique field identifier, so we can cheaply
 	// check for field duplicates without maintaining an extra map.
 	Id int
@@ -587,6 +1883,18 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 	fieldsList := make([]fieldInfo, 0, n)
 	inlineMap := -1
 	inlineUnmarshalers := [][]int(nil)
+	nodeField := -1
+	aliases := map[string]string(nil)
+	addAlias := func(alias, key string) error {
+		if _, found := aliases[alias]; found {
+			return errors.New("duplicated alias '" + alias + "' in struct " + st.String())
+		}
+		if aliases == nil {
+			aliases = make(map[string]string)
+		}
+		aliases[alias] = key
+		return nil
+	}
 	for i := 0; i != n; i++ {
 		field := st.Field(i)
 		if field.PkgPath != "" && !field.Anonymous {
@@ -604,23 +1912,64 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 		}
 
 		inline := false
+		node := false
+		var fieldAliases []string
 		fields := strings.Split(tag, ",")
 		if len(fields) > 1 {
 			for _, flag := range fields[1:] {
 				switch flag {
 				case "omitempty":
 					info.OmitEmpty = true
+				case "keepzero":
+					info.KeepZero = true
 				case "flow":
 					info.Flow = true
-				case "inline":
+				case "bytes":
+					info.Bytes = true
+				case "unix":
+					info.Epoch = time.Second
+				case "unixmilli":
+					info.Epoch = time.Millisecond
+				case "inline", "remain":
 					inline = true
+				case "node":
+					node = true
 				default:
+					if alias := strings.TrimPrefix(flag, "alias="); alias != flag && alias != "" {
+						fieldAliases = append(fieldAliases, alias)
+						continue
+					}
 					return nil, errors.New(fmt.Sprintf("unsupported flag %q in tag %q of type %s", flag, tag, st))
 				}
 			}
 			tag = fields[0]
 		}
 
+		if info.Bytes && !isByteSizeType(field.Type) {
+			return nil, errors.New("option ,bytes needs an integer field in struct " + st.String())
+		}
+
+		if info.Epoch != 0 {
+			ftype := field.Type
+			for ftype.Kind() == reflect.Ptr {
+				ftype = ftype.Elem()
+			}
+			if ftype != timeType {
+				return nil, errors.New("options ,unix and ,unixmilli need a time.Time field in struct " + st.String())
+			}
+		}
+
+		if node {
+			if tag != "-" || (field.Type != nodeType && field.Type != reflect.PtrTo(nodeType)) {
+				return nil, errors.New("option ,node needs a yaml.Node or *yaml.Node field named \"-\" in struct " + st.String())
+			}
+			if nodeField >= 0 {
+				return nil, errors.New("multiple ,node fields in struct " + st.String())
+			}
+			nodeField = i
+			continue
+		}
+
 		if inline {
 			switch field.Type.Kind() {
 			case reflect.Map:
@@ -663,6 +2012,11 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 						fieldsMap[finfo.Key] = finfo
 						fieldsList = append(fieldsList, finfo)
 					}
+					for alias, key := range sinfo.Aliases {
+						if err := addAlias(alias, key); err != nil {
+							return nil, err
+						}
+					}
 				}
 			default:
 				return nil, errors.New("option ,inline may only be used on a struct or map field")
@@ -681,16 +2035,30 @@ func getStructInfo(st reflect.Type) (*structInfo, error) {
 			return nil, errors.New(msg)
 		}
 
+		for _, alias := range fieldAliases {
+			if err := addAlias(alias, info.Key); err != nil {
+				return nil, err
+			}
+		}
+
 		info.Id = len(fieldsList)
 		fieldsList = append(fieldsList, info)
 		fieldsMap[info.Key] = info
 	}
 
+	for alias := range aliases {
+		if _, found := fieldsMap[alias]; found {
+			return nil, errors.New("alias '" + alias + "' conflicts with a key in struct " + st.String())
+		}
+	}
+
 	sinfo = &structInfo{
 		FieldsMap:          fieldsMap,
 		FieldsList:         fieldsList,
 		InlineMap:          inlineMap,
 		InlineUnmarshalers: inlineUnmarshalers,
+		NodeField:          nodeField,
+		Aliases:            aliases,
 	}
 
 	fieldMapMutex.Lock()
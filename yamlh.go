@@ -237,6 +237,10 @@ type yaml_token_t struct {
 	// The scalar style (for yaml_SCALAR_TOKEN).
 	style yaml_scalar_style_t
 
+	// The indentation indicator of a block scalar, or 0 if it has none
+	// (for yaml_SCALAR_TOKEN).
+	block_indent int
+
 	// The version directive major/minor (for yaml_VERSION_DIRECTIVE_TOKEN).
 	major, minor int8
 
@@ -334,6 +338,13 @@ type yaml_event_t struct {
 
 	// The style (for yaml_SCALAR_EVENT, yaml_SEQUENCE_START_EVENT, yaml_MAPPING_START_EVENT).
 	style yaml_style_t
+
+	// The indentation indicator of a block scalar, or 0 if it has none
+	// (for yaml_SCALAR_EVENT).
+	block_indent int
+
+	// The beginning of the value itself, after any properties (for yaml_SCALAR_EVENT).
+	value_start_mark yaml_mark_t
 }
 
 func (e *yaml_event_t) scalar_style() yaml_scalar_style_t     { return yaml_scalar_style_t(e.style) }
@@ -619,6 +630,9 @@ type yaml_parser_t struct {
 	preserve_blank_lines bool // Whether to preserve blank lines
 	blank_lines_before   int  // Number of blank lines before current event
 	blank_lines_after    int  // Number of blank lines after current event
+	entry_blank_lines    int  // Number of blank lines before the current sequence entry
+
+	lenient_escapes bool // Whether to keep unknown escapes in double-quoted scalars as written
 
 	// Scanner stuff
 
@@ -772,6 +786,19 @@ type yaml_emitter_t struct {
 	indention  bool // If the last character was an indentation character (' ', '-', '?', ':')?
 	open_ended bool // If an explicit document end is required?
 
+	flow_wrap_each bool // Write every entry of flow collections on its own line.
+
+	flow_trailing_comma bool // Write a comma after the last entry of wrapped flow collections.
+
+	sequence_item_spacing int // The least number of blank lines between block sequence items.
+
+	escape_func func(r rune) (string, bool) // Override the text written for characters in double-quoted scalars.
+
+	block_scalar_indent int // The indentation indicator to write block scalars with, or 0 to only write it when needed.
+	block_indent        int // The indentation indicator to write for the block scalar being emitted, or 0.
+
+	multiline_literal bool // Prefer the literal style for multi-line scalars with trailing spaces on their lines.
+
 	space_above bool // Is there's an empty line above?
 	foot_indent int  // The indent used to write the foot comment above, or -1 if none.
 
@@ -806,6 +833,10 @@ type yaml_emitter_t struct {
 
 	key_line_comment []byte
 
+	comments_flush_left      bool // Whether head and foot comments are written at the first column.
+	blank_after_head_comment bool // Whether head comments of several lines are followed by a blank line.
+	comment_width            int  // The width at which head and foot comments are wrapped, or 0 if they aren't.
+
 	// Blank line tracking for round-trip preservation
 	preserve_blank_lines bool // Whether to preserve blank lines
 	blank_lines_before   int  // Number of blank lines to emit before current event